@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"nexora-backend/config"
+	"nexora-backend/services"
+)
+
+// parseDate accepts either a date (2006-01-02) or a full RFC 3339 timestamp
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func main() {
+	fromFlag := flag.String("from", time.Now().AddDate(0, 0, -7).Format("2006-01-02"), "reconcile payments created on or after this date (YYYY-MM-DD or RFC 3339)")
+	toFlag := flag.String("to", "", "reconcile payments created before this date (YYYY-MM-DD or RFC 3339, default now)")
+	flag.Parse()
+
+	from, err := parseDate(*fromFlag)
+	if err != nil {
+		log.Fatalf("Invalid -from %q: %v", *fromFlag, err)
+	}
+	to := time.Now()
+	if *toFlag != "" {
+		if to, err = parseDate(*toFlag); err != nil {
+			log.Fatalf("Invalid -to %q: %v", *toFlag, err)
+		}
+	}
+	if !from.Before(to) {
+		log.Fatalf("-from must be before -to")
+	}
+
+	cfg := config.Load()
+	db := config.InitDatabase()
+
+	gateway, err := services.NewPaymentGateway(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize payment gateway:", err)
+	}
+
+	log.Printf("Reconciling pending %s payments created between %s and %s", gateway.Name(),
+		from.Format(time.RFC3339), to.Format(time.RFC3339))
+
+	report, err := services.ReconcilePayments(context.Background(), db, gateway, from, to)
+	if err != nil {
+		log.Fatal("Reconciliation failed:", err)
+	}
+
+	for _, m := range report.Mismatches {
+		log.Printf("Mismatch: %s was %s locally but %s at the gateway -> %s (%s) %s",
+			m.Reference, m.LocalStatus, m.GatewayStatus, m.NewStatus, m.Outcome, m.Detail)
+	}
+	log.Printf("Checked %d pending payments: %d mismatches, %d unknown at the gateway, %d failed",
+		report.Checked, len(report.Mismatches), report.NotFound, report.Failed)
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
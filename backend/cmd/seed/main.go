@@ -5,6 +5,7 @@ import (
 
 	"nexora-backend/config"
 	"nexora-backend/models"
+	"nexora-backend/services"
 
 	"github.com/google/uuid"
 )
@@ -23,12 +24,37 @@ func main() {
 		&models.ProductVariant{},
 		&models.Review{},
 		&models.CartItem{},
+		&models.CartRecovery{},
+		&models.OutboundEmail{},
+		&models.DomainEvent{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.WebhookDeliveryAttempt{},
 		&models.WishlistItem{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderStatusHistory{},
 		&models.Payment{},
+		&models.Refund{},
+		&models.PaymentNotification{},
+		&models.ReturnRequest{},
+		&models.ReturnItem{},
+		&models.ReturnStatusHistory{},
+		&models.IdempotencyKey{},
+		&models.StockMovement{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.ShippingZone{},
+		&models.ShippingZoneRegion{},
+		&models.ShippingRate{},
+		&models.ShippingCourier{},
+		&models.ShipmentEvent{},
 	)
 
+	if err := services.EnsureProductSearch(config.DB); err != nil {
+		log.Fatalf("Failed to set up product search: %v", err)
+	}
+
 	log.Println("Seeding database...")
 
 	// Create categories
@@ -305,8 +331,16 @@ func main() {
 			}
 		}
 	}
+	if err := services.RecordOpeningBalances(config.DB); err != nil {
+		log.Fatalf("Failed to record opening stock balances: %v", err)
+	}
 	log.Println("✓ Products seeded")
 
+	if err := services.EnsureShippingRates(config.DB); err != nil {
+		log.Fatalf("Failed to create shipping rates: %v", err)
+	}
+	log.Println("✓ Shipping rates seeded")
+
 	// Create admin user
 	googleID := "admin-seed-account"
 	adminUser := models.User{
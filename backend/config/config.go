@@ -1,27 +1,56 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port                 string
-	Env                  string
-	DBHost               string
-	DBPort               string
-	DBUser               string
-	DBPassword           string
-	DBName               string
-	JWTSecret            string
-	GoogleClientID       string
-	GoogleClientSecret   string
-	GoogleRedirectURL    string
-	MidtransServerKey    string
-	MidtransClientKey    string
-	MidtransIsProduction bool
-	FrontendURL          string
+	Port                     string
+	Env                      string
+	DBHost                   string
+	DBPort                   string
+	DBUser                   string
+	DBPassword               string
+	DBName                   string
+	JWTSecret                string
+	GoogleClientID           string
+	GoogleClientSecret       string
+	GoogleRedirectURL        string
+	MidtransServerKey        string
+	MidtransClientKey        string
+	MidtransIsProduction     bool
+	PaymentProvider          string
+	FrontendURL              string
+	APIURL                   string
+	PendingOrderTTL          time.Duration
+	OrderExpiryInterval      time.Duration
+	IdempotencyTTL           time.Duration
+	TrackingAPIURL           string
+	TrackingAPIKey           string
+	TrackingCacheTTL         time.Duration
+	ShipmentPollInterval     time.Duration
+	ReturnWindow             time.Duration
+	PaymentReconcileAfter    time.Duration
+	PaymentReconcileInterval time.Duration
+	MailDriver               string
+	MailFrom                 string
+	MailOutboxDir            string
+	SMTPHost                 string
+	SMTPPort                 string
+	SMTPUsername             string
+	SMTPPassword             string
+	AbandonedCartAfter       time.Duration
+	AbandonedCartInterval    time.Duration
+	AdminEmail               string
+	EmailOutboxInterval      time.Duration
+	EventDispatchInterval    time.Duration
+	LowStockThreshold        int
+	WebhookDeliveryInterval  time.Duration
 }
 
 var AppConfig *Config
@@ -30,21 +59,47 @@ func Load() *Config {
 	godotenv.Load()
 
 	AppConfig = &Config{
-		Port:                 getEnv("PORT", "8080"),
-		Env:                  getEnv("ENV", "development"),
-		DBHost:               getEnv("DB_HOST", "localhost"),
-		DBPort:               getEnv("DB_PORT", "5432"),
-		DBUser:               getEnv("DB_USER", "postgres"),
-		DBPassword:           getEnv("DB_PASSWORD", ""),
-		DBName:               getEnv("DB_NAME", "nexora"),
-		JWTSecret:            getEnv("JWT_SECRET", "secret"),
-		GoogleClientID:       getEnv("GOOGLE_CLIENT_ID", ""),
-		GoogleClientSecret:   getEnv("GOOGLE_CLIENT_SECRET", ""),
-		GoogleRedirectURL:    getEnv("GOOGLE_REDIRECT_URL", "http://localhost:8080/api/auth/google/callback"),
-		MidtransServerKey:    getEnv("MIDTRANS_SERVER_KEY", ""),
-		MidtransClientKey:    getEnv("MIDTRANS_CLIENT_KEY", ""),
-		MidtransIsProduction: getEnv("MIDTRANS_IS_PRODUCTION", "false") == "true",
-		FrontendURL:          getEnv("FRONTEND_URL", "http://localhost:3000"),
+		Port:                     getEnv("PORT", "8080"),
+		Env:                      getEnv("ENV", "development"),
+		DBHost:                   getEnv("DB_HOST", "localhost"),
+		DBPort:                   getEnv("DB_PORT", "5432"),
+		DBUser:                   getEnv("DB_USER", "postgres"),
+		DBPassword:               getEnv("DB_PASSWORD", ""),
+		DBName:                   getEnv("DB_NAME", "nexora"),
+		JWTSecret:                getEnv("JWT_SECRET", "secret"),
+		GoogleClientID:           getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret:       getEnv("GOOGLE_CLIENT_SECRET", ""),
+		GoogleRedirectURL:        getEnv("GOOGLE_REDIRECT_URL", "http://localhost:8080/api/auth/google/callback"),
+		MidtransServerKey:        getEnv("MIDTRANS_SERVER_KEY", ""),
+		MidtransClientKey:        getEnv("MIDTRANS_CLIENT_KEY", ""),
+		MidtransIsProduction:     getEnv("MIDTRANS_IS_PRODUCTION", "false") == "true",
+		PaymentProvider:          getEnv("PAYMENT_PROVIDER", "midtrans"),
+		FrontendURL:              getEnv("FRONTEND_URL", "http://localhost:3000"),
+		APIURL:                   getEnv("API_URL", "http://localhost:8080"),
+		PendingOrderTTL:          getDuration("PENDING_ORDER_TTL", 24*time.Hour),
+		OrderExpiryInterval:      getDuration("ORDER_EXPIRY_INTERVAL", 5*time.Minute),
+		IdempotencyTTL:           getDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		TrackingAPIURL:           getEnv("TRACKING_API_URL", ""),
+		TrackingAPIKey:           getEnv("TRACKING_API_KEY", ""),
+		TrackingCacheTTL:         getDuration("TRACKING_CACHE_TTL", 10*time.Minute),
+		ShipmentPollInterval:     getDuration("SHIPMENT_POLL_INTERVAL", 30*time.Minute),
+		ReturnWindow:             getDuration("RETURN_WINDOW", 7*24*time.Hour),
+		PaymentReconcileAfter:    getDuration("PAYMENT_RECONCILE_AFTER", 15*time.Minute),
+		PaymentReconcileInterval: getDuration("PAYMENT_RECONCILE_INTERVAL", 10*time.Minute),
+		MailDriver:               getEnv("MAIL_DRIVER", "log"),
+		MailFrom:                 getEnv("MAIL_FROM", "Nexora <no-reply@nexora.local>"),
+		MailOutboxDir:            getEnv("MAIL_OUTBOX_DIR", "tmp/mail"),
+		SMTPHost:                 getEnv("SMTP_HOST", ""),
+		SMTPPort:                 getEnv("SMTP_PORT", "587"),
+		SMTPUsername:             getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:             getEnv("SMTP_PASSWORD", ""),
+		AbandonedCartAfter:       getDuration("ABANDONED_CART_AFTER", 24*time.Hour),
+		AbandonedCartInterval:    getDuration("ABANDONED_CART_INTERVAL", time.Hour),
+		AdminEmail:               getEnv("ADMIN_EMAIL", ""),
+		EmailOutboxInterval:      getDuration("EMAIL_OUTBOX_INTERVAL", time.Minute),
+		EventDispatchInterval:    getDuration("EVENT_DISPATCH_INTERVAL", 5*time.Second),
+		LowStockThreshold:        getInt("LOW_STOCK_THRESHOLD", 5),
+		WebhookDeliveryInterval:  getDuration("WEBHOOK_DELIVERY_INTERVAL", 10*time.Second),
 	}
 
 	return AppConfig
@@ -56,3 +111,29 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid number %q for %s, using %d", value, key, defaultValue)
+		return defaultValue
+	}
+	return number
+}
+
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration %q for %s, using %s", value, key, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
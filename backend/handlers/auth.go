@@ -9,6 +9,7 @@ import (
 
 	"nexora-backend/config"
 	"nexora-backend/models"
+	"nexora-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -16,6 +17,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"gorm.io/gorm"
 )
 
 var googleOauthConfig *oauth2.Config
@@ -84,7 +86,7 @@ func GoogleCallback(c *gin.Context) {
 			GoogleID: &userInfo.ID,
 			Role:     "customer",
 		}
-		if err := config.DB.Create(&user).Error; err != nil {
+		if err := createUser(&user, "google"); err != nil {
 			c.Redirect(http.StatusTemporaryRedirect, config.AppConfig.FrontendURL+"/auth/error?message=create_failed")
 			return
 		}
@@ -95,6 +97,9 @@ func GoogleCallback(c *gin.Context) {
 		config.DB.Save(&user)
 	}
 
+	// Carry over the guest cart if its cookie came along
+	mergeGuestCart(c, user.ID)
+
 	// Generate JWT
 	jwtToken, err := generateJWT(user)
 	if err != nil {
@@ -187,11 +192,14 @@ func Register(c *gin.Context) {
 		Role:     "customer",
 	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
+	if err := createUser(&user, "password"); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
+	// Carry over anything the guest put in their cart
+	mergeGuestCart(c, user.ID)
+
 	// Generate JWT
 	token, err := generateJWT(user)
 	if err != nil {
@@ -236,6 +244,9 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// Carry over anything the guest put in their cart
+	mergeGuestCart(c, user.ID)
+
 	// Generate JWT
 	token, err := generateJWT(user)
 	if err != nil {
@@ -258,3 +269,18 @@ func checkPassword(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// createUser stores a new user and publishes EventUserRegistered with it
+func createUser(user *models.User, provider string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return services.PublishEvent(tx, services.EventUserRegistered, user.ID, services.UserRegisteredEvent{
+			UserID:   user.ID,
+			Email:    user.Email,
+			Name:     user.Name,
+			Provider: provider,
+		})
+	})
+}
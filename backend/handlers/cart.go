@@ -1,48 +1,148 @@
 package handlers
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 
 	"nexora-backend/config"
 	"nexora-backend/models"
+	"nexora-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
-// GetCart returns the user's cart items
+// Guest carts are identified by an opaque token sent as a header or cookie
+const (
+	cartTokenHeader = "X-Cart-Token"
+	cartTokenCookie = "cart_token"
+	cartTokenMaxAge = 30 * 24 * 60 * 60
+)
+
+// cartToken returns the guest cart token sent with the request, if any
+func cartToken(c *gin.Context) string {
+	if token := c.GetHeader(cartTokenHeader); token != "" {
+		return token
+	}
+	token, _ := c.Cookie(cartTokenCookie)
+	return token
+}
+
+// issueCartToken returns the guest's cart token, creating one if the request
+// had none, and sends it back as a header and cookie
+func issueCartToken(c *gin.Context) (string, error) {
+	token := cartToken(c)
+	if token == "" {
+		var err error
+		if token, err = services.NewCartToken(); err != nil {
+			return "", err
+		}
+	}
+	c.Header(cartTokenHeader, token)
+	c.SetCookie(cartTokenCookie, token, cartTokenMaxAge, "/", "", config.AppConfig.Env == "production", true)
+	return token, nil
+}
+
+// cartScope limits a query to the signed in user's cart or the guest's cart.
+// ok is false when the request carries neither.
+func cartScope(c *gin.Context) (scope func(db *gorm.DB) *gorm.DB, ok bool) {
+	if userID, exists := c.Get("user_id"); exists {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("user_id = ?", userID)
+		}, true
+	}
+	if token := cartToken(c); token != "" {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("cart_token = ? AND user_id IS NULL", token)
+		}, true
+	}
+	return nil, false
+}
+
+// mergeGuestCart moves the guest cart sent with the request into the user's
+// cart after they sign in. Failing to merge never fails the sign in.
+func mergeGuestCart(c *gin.Context, userID uuid.UUID) int {
+	token := cartToken(c)
+	if token == "" {
+		return 0
+	}
+
+	merged, err := services.MergeGuestCart(config.DB, token, userID)
+	if err != nil {
+		log.Printf("Failed to merge guest cart into user %s: %v", userID, err)
+		return 0
+	}
+	c.SetCookie(cartTokenCookie, "", -1, "/", "", config.AppConfig.Env == "production", true)
+	return merged
+}
+
+// respondNotEnoughStock reports that a cart quantity is more than is left in stock
+func respondNotEnoughStock(c *gin.Context, product models.Product, variant *models.ProductVariant) {
+	available := services.AvailableStock(product, variant)
+	c.JSON(http.StatusConflict, gin.H{
+		"error":     fmt.Sprintf("Only %d of %s left in stock", available, product.Name),
+		"available": available,
+	})
+}
+
+// GetCart returns the cart items of the signed in user or guest cart token,
+// with warnings about items that became unavailable, ran low or changed price.
+// Unavailable and out of stock items do not count towards the subtotal.
 func GetCart(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	cartItems := []models.CartItem{}
+	warnings := []services.CartWarning{}
+	if scope, ok := cartScope(c); ok {
+		if err := config.DB.Scopes(services.PreloadCartItems, scope).Find(&cartItems).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+			return
+		}
 
-	var cartItems []models.CartItem
-	if err := config.DB.Preload("Product.Images").Preload("Variant").
-		Where("user_id = ?", userID).Find(&cartItems).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
-		return
+		var err error
+		if warnings, err = services.ValidateCart(config.DB, cartItems); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check cart"})
+			return
+		}
 	}
 
 	// Calculate totals
 	var subtotal float64
 	for _, item := range cartItems {
-		price := item.Product.BasePrice
-		if item.Variant != nil {
-			price += item.Variant.PriceModifier
+		if !services.CartItemAvailable(item) || services.AvailableStock(item.Product, item.Variant) <= 0 {
+			continue
 		}
-		subtotal += price * float64(item.Quantity)
+		subtotal += services.UnitPrice(item.Product, item.Variant) * float64(item.Quantity)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"items":    cartItems,
 		"subtotal": subtotal,
 		"count":    len(cartItems),
+		"warnings": warnings,
 	})
 }
 
-// AddToCart adds an item to the cart
-func AddToCart(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	parsedUserID, _ := uuid.Parse(userID.(string))
+// AcceptCartPrices accepts the current prices of the items in the cart, after
+// the customer has seen the price change warnings
+func AcceptCartPrices(c *gin.Context) {
+	cartItems := []models.CartItem{}
+	if scope, ok := cartScope(c); ok {
+		if err := config.DB.Scopes(services.PreloadCartItems, scope).Find(&cartItems).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+			return
+		}
+		if err := services.AcceptCartPrices(config.DB, cartItems); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": cartItems})
+}
 
+// AddToCart adds an item to the cart. Guests without a cart token are given one.
+func AddToCart(c *gin.Context) {
 	var input struct {
 		ProductID string `json:"product_id" binding:"required"`
 		VariantID string `json:"variant_id"`
@@ -67,27 +167,69 @@ func AddToCart(c *gin.Context) {
 		return
 	}
 
+	// The variant must belong to the product
+	var variant *models.ProductVariant
+	if input.VariantID != "" {
+		variantID, err := uuid.Parse(input.VariantID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+			return
+		}
+		variant = &models.ProductVariant{}
+		if err := config.DB.First(variant, "id = ? AND product_id = ?", variantID, productID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+			return
+		}
+	}
+
 	quantity := input.Quantity
 	if quantity <= 0 {
 		quantity = 1
 	}
 
+	// Work out whose cart this is
+	cartItem := models.CartItem{
+		ProductID:  productID,
+		Quantity:   quantity,
+		AddedPrice: services.UnitPrice(product, variant),
+	}
+	if userID, exists := c.Get("user_id"); exists {
+		parsedUserID, _ := uuid.Parse(userID.(string))
+		cartItem.UserID = &parsedUserID
+	} else {
+		token, err := issueCartToken(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create cart"})
+			return
+		}
+		cartItem.CartToken = token
+	}
+
 	// Check if item already in cart
 	var existingItem models.CartItem
-	query := config.DB.Where("user_id = ? AND product_id = ?", parsedUserID, productID)
+	query := config.DB.Where("product_id = ?", productID)
+	if cartItem.UserID != nil {
+		query = query.Where("user_id = ?", *cartItem.UserID)
+	} else {
+		query = query.Where("cart_token = ? AND user_id IS NULL", cartItem.CartToken)
+	}
 
-	var variantID *uuid.UUID
-	if input.VariantID != "" {
-		vid, _ := uuid.Parse(input.VariantID)
-		variantID = &vid
-		query = query.Where("variant_id = ?", variantID)
+	if variant != nil {
+		cartItem.VariantID = &variant.ID
+		query = query.Where("variant_id = ?", variant.ID)
 	} else {
 		query = query.Where("variant_id IS NULL")
 	}
 
 	if err := query.First(&existingItem).Error; err == nil {
-		// Update quantity
+		if existingItem.Quantity+quantity > services.AvailableStock(product, variant) {
+			respondNotEnoughStock(c, product, variant)
+			return
+		}
+
+		// Update quantity; the customer has just seen the current price
 		existingItem.Quantity += quantity
+		existingItem.AddedPrice = cartItem.AddedPrice
 		if err := config.DB.Save(&existingItem).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
 			return
@@ -96,14 +238,12 @@ func AddToCart(c *gin.Context) {
 		return
 	}
 
-	// Create new cart item
-	cartItem := models.CartItem{
-		UserID:    parsedUserID,
-		ProductID: productID,
-		VariantID: variantID,
-		Quantity:  quantity,
+	if quantity > services.AvailableStock(product, variant) {
+		respondNotEnoughStock(c, product, variant)
+		return
 	}
 
+	// Create new cart item
 	if err := config.DB.Create(&cartItem).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add to cart"})
 		return
@@ -115,11 +255,11 @@ func AddToCart(c *gin.Context) {
 
 // UpdateCartItem updates the quantity of a cart item
 func UpdateCartItem(c *gin.Context) {
-	userID, _ := c.Get("user_id")
 	itemID := c.Param("id")
 
+	scope, ok := cartScope(c)
 	var cartItem models.CartItem
-	if err := config.DB.Where("id = ? AND user_id = ?", itemID, userID).First(&cartItem).Error; err != nil {
+	if !ok || config.DB.Scopes(services.PreloadCartItems, scope).Where("id = ?", itemID).First(&cartItem).Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
 		return
 	}
@@ -133,8 +273,16 @@ func UpdateCartItem(c *gin.Context) {
 		return
 	}
 
-	cartItem.Quantity = input.Quantity
-	if err := config.DB.Save(&cartItem).Error; err != nil {
+	if !services.CartItemAvailable(cartItem) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This product is no longer available"})
+		return
+	}
+	if input.Quantity > services.AvailableStock(cartItem.Product, cartItem.Variant) {
+		respondNotEnoughStock(c, cartItem.Product, cartItem.Variant)
+		return
+	}
+
+	if err := config.DB.Model(&cartItem).Update("quantity", input.Quantity).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
 		return
 	}
@@ -144,11 +292,11 @@ func UpdateCartItem(c *gin.Context) {
 
 // RemoveFromCart removes an item from the cart
 func RemoveFromCart(c *gin.Context) {
-	userID, _ := c.Get("user_id")
 	itemID := c.Param("id")
 
+	scope, ok := cartScope(c)
 	var cartItem models.CartItem
-	if err := config.DB.Where("id = ? AND user_id = ?", itemID, userID).First(&cartItem).Error; err != nil {
+	if !ok || config.DB.Scopes(scope).Where("id = ?", itemID).First(&cartItem).Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
 		return
 	}
@@ -163,14 +311,89 @@ func RemoveFromCart(c *gin.Context) {
 
 // ClearCart removes all items from the cart
 func ClearCart(c *gin.Context) {
+	if scope, ok := cartScope(c); ok {
+		if err := config.DB.Scopes(scope).Delete(&models.CartItem{}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cart cleared"})
+}
+
+// MergeCart moves the guest cart identified by the cart token into the signed
+// in user's cart
+func MergeCart(c *gin.Context) {
 	userID, _ := c.Get("user_id")
+	parsedUserID, _ := uuid.Parse(userID.(string))
+
+	merged := mergeGuestCart(c, parsedUserID)
+	c.JSON(http.StatusOK, gin.H{"merged": merged})
+}
+
+// transparentGIF is the 1x1 image served as the open tracking pixel
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// TrackCartRecoveryOpen records that an abandoned cart email was opened and
+// serves the tracking pixel
+func TrackCartRecoveryOpen(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err == nil && services.VerifyCartRecovery(id, c.Query("sig"), config.AppConfig.JWTSecret) {
+		if err := services.TrackCartRecoveryOpen(config.DB, id); err != nil {
+			log.Printf("Failed to track cart recovery open %s: %v", id, err)
+		}
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/gif", transparentGIF)
+}
+
+// RecoverCart restores the items of an abandoned cart email from its signed
+// link, into the signed in customer's cart or otherwise a guest cart
+func RecoverCart(c *gin.Context) {
+	var input struct {
+		ID  string `json:"id" binding:"required"`
+		Sig string `json:"sig" binding:"required"`
+	}
 
-	if err := config.DB.Where("user_id = ?", userID).Delete(&models.CartItem{}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Cart cleared"})
+	id, err := uuid.Parse(input.ID)
+	if err != nil || !services.VerifyCartRecovery(id, input.Sig, config.AppConfig.JWTSecret) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid recovery link"})
+		return
+	}
+
+	var recovery models.CartRecovery
+	if err := config.DB.First(&recovery, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recovery link not found"})
+		return
+	}
+
+	// Restore into the customer's own cart when they are signed in as the recipient
+	var owner *uuid.UUID
+	token := ""
+	if userID, exists := c.Get("user_id"); exists && userID.(string) == recovery.UserID.String() {
+		owner = &recovery.UserID
+	} else if token, err = issueCartToken(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create cart"})
+		return
+	}
+
+	restored, err := services.RestoreRecoveredCart(config.DB, &recovery, owner, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore cart"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"restored": restored})
 }
 
 // GetWishlist returns the user's wishlist items
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"nexora-backend/config"
+	"nexora-backend/models"
+	"nexora-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// couponInput is the request body for creating and updating coupons.
+// Pointer fields are left unchanged on update when omitted.
+type couponInput struct {
+	Code         *string    `json:"code"`
+	Description  *string    `json:"description"`
+	Type         *string    `json:"type"`
+	Value        *float64   `json:"value"`
+	MaxDiscount  *float64   `json:"max_discount"`
+	MinSpend     *float64   `json:"min_spend"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	UsageLimit   *int       `json:"usage_limit"`
+	PerUserLimit *int       `json:"per_user_limit"`
+	IsActive     *bool      `json:"is_active"`
+	CategoryIDs  *[]string  `json:"category_ids"`
+	ProductIDs   *[]string  `json:"product_ids"`
+}
+
+// apply copies the provided fields onto the coupon and validates the result
+func (input *couponInput) apply(coupon *models.Coupon) error {
+	if input.Code != nil {
+		coupon.Code = services.NormalizeCouponCode(*input.Code)
+	}
+	if input.Description != nil {
+		coupon.Description = *input.Description
+	}
+	if input.Type != nil {
+		coupon.Type = models.CouponType(*input.Type)
+	}
+	if input.Value != nil {
+		coupon.Value = *input.Value
+	}
+	if input.MaxDiscount != nil {
+		coupon.MaxDiscount = *input.MaxDiscount
+	}
+	if input.MinSpend != nil {
+		coupon.MinSpend = *input.MinSpend
+	}
+	if input.StartsAt != nil {
+		coupon.StartsAt = input.StartsAt
+	}
+	if input.EndsAt != nil {
+		coupon.EndsAt = input.EndsAt
+	}
+	if input.UsageLimit != nil {
+		coupon.UsageLimit = *input.UsageLimit
+	}
+	if input.PerUserLimit != nil {
+		coupon.PerUserLimit = *input.PerUserLimit
+	}
+	if input.IsActive != nil {
+		coupon.IsActive = *input.IsActive
+	}
+
+	switch {
+	case coupon.Code == "":
+		return errors.New("Code is required")
+	case coupon.Type != models.CouponTypePercentage && coupon.Type != models.CouponTypeFixed &&
+		coupon.Type != models.CouponTypeFreeShipping:
+		return errors.New("Type must be percentage, fixed or free_shipping")
+	case coupon.Type == models.CouponTypePercentage && (coupon.Value <= 0 || coupon.Value > 100):
+		return errors.New("Percentage value must be between 0 and 100")
+	case coupon.Type == models.CouponTypeFixed && coupon.Value <= 0:
+		return errors.New("Fixed value must be greater than 0")
+	case coupon.MaxDiscount < 0 || coupon.MinSpend < 0 || coupon.UsageLimit < 0 || coupon.PerUserLimit < 0:
+		return errors.New("Limits and amounts cannot be negative")
+	case coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.EndsAt.After(*coupon.StartsAt):
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// replaceScope replaces the coupon's category and product scope with the given IDs
+func (input *couponInput) replaceScope(tx *gorm.DB, coupon *models.Coupon) error {
+	if input.CategoryIDs != nil {
+		var categories []models.Category
+		if ids := parseUUIDs(*input.CategoryIDs); len(ids) > 0 {
+			if err := tx.Where("id IN ?", ids).Find(&categories).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(coupon).Association("Categories").Replace(categories); err != nil {
+			return err
+		}
+	}
+	if input.ProductIDs != nil {
+		var products []models.Product
+		if ids := parseUUIDs(*input.ProductIDs); len(ids) > 0 {
+			if err := tx.Where("id IN ?", ids).Find(&products).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(coupon).Association("Products").Replace(products); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseUUIDs(values []string) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, value := range values {
+		if id, err := uuid.Parse(value); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// GetCoupons returns all coupons with their scope (admin only)
+func GetCoupons(c *gin.Context) {
+	query := config.DB.Preload("Categories").Preload("Products")
+	if search := c.Query("search"); search != "" {
+		query = query.Where("code ILIKE ?", "%"+strings.TrimSpace(search)+"%")
+	}
+
+	var coupons []models.Coupon
+	if err := query.Order("created_at desc").Find(&coupons).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupons"})
+		return
+	}
+
+	c.JSON(http.StatusOK, coupons)
+}
+
+// CreateCoupon creates a new coupon (admin only)
+func CreateCoupon(c *gin.Context) {
+	var input couponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon := models.Coupon{IsActive: true}
+	if err := input.apply(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existing int64
+	config.DB.Unscoped().Model(&models.Coupon{}).Where("code = ?", coupon.Code).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Create without associations so the scope is set from IDs only
+		if err := tx.Omit("Categories", "Products").Create(&coupon).Error; err != nil {
+			return err
+		}
+		return input.replaceScope(tx, &coupon)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create coupon"})
+		return
+	}
+
+	config.DB.Preload("Categories").Preload("Products").First(&coupon, "id = ?", coupon.ID)
+	c.JSON(http.StatusCreated, coupon)
+}
+
+// UpdateCoupon updates a coupon (admin only)
+func UpdateCoupon(c *gin.Context) {
+	id := c.Param("id")
+
+	var coupon models.Coupon
+	if err := config.DB.First(&coupon, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	var input couponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previousCode := coupon.Code
+	if err := input.apply(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if coupon.Code != previousCode {
+		var existing int64
+		config.DB.Unscoped().Model(&models.Coupon{}).Where("code = ? AND id != ?", coupon.Code, coupon.ID).Count(&existing)
+		if existing > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+			return
+		}
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// usage_count is owned by checkout, never overwritten from here
+		if err := tx.Omit("usage_count", "Categories", "Products").Save(&coupon).Error; err != nil {
+			return err
+		}
+		return input.replaceScope(tx, &coupon)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update coupon"})
+		return
+	}
+
+	config.DB.Preload("Categories").Preload("Products").First(&coupon, "id = ?", coupon.ID)
+	c.JSON(http.StatusOK, coupon)
+}
+
+// DeleteCoupon soft deletes a coupon (admin only)
+func DeleteCoupon(c *gin.Context) {
+	id := c.Param("id")
+
+	var coupon models.Coupon
+	if err := config.DB.First(&coupon, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	if err := config.DB.Delete(&coupon).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Coupon deleted successfully"})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"nexora-backend/config"
+	"nexora-backend/models"
+	"nexora-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetEmails lists queued and sent emails, newest first (admin only)
+func GetEmails(c *gin.Context) {
+	p := pageParams(c, 50)
+
+	query := config.DB.Model(&models.OutboundEmail{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var emails []models.OutboundEmail
+	if err := query.Omit("html").Order("created_at desc").Offset(p.Offset()).Limit(p.Limit).Find(&emails).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch emails"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pageResponse(p, "emails", emails, total))
+}
+
+// RetryEmail queues an email that was given up on to be sent again (admin only)
+func RetryEmail(c *gin.Context) {
+	var email models.OutboundEmail
+	if err := config.DB.First(&email, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email not found"})
+		return
+	}
+
+	if email.Status == models.EmailStatusSent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email was already sent"})
+		return
+	}
+
+	if err := services.RetryEmail(config.DB, &email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, email)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"nexora-backend/config"
+	"nexora-backend/models"
+	"nexora-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetEvents lists domain events in the outbox, newest first (admin only)
+func GetEvents(c *gin.Context) {
+	p := pageParams(c, 50)
+
+	query := config.DB.Model(&models.DomainEvent{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := c.Query("type"); eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+	if aggregateID := c.Query("aggregate_id"); aggregateID != "" {
+		query = query.Where("aggregate_id = ?", aggregateID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var events []models.DomainEvent
+	if err := query.Order("created_at desc").Offset(p.Offset()).Limit(p.Limit).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pageResponse(p, "events", events, total))
+}
+
+// RetryEvent delivers a failed event again to the subscribers that have not
+// handled it (admin only)
+func RetryEvent(c *gin.Context) {
+	var event models.DomainEvent
+	if err := config.DB.First(&event, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+
+	if event.Status == models.EventStatusDelivered {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event was already delivered"})
+		return
+	}
+
+	if err := services.RetryEvent(config.DB, &event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
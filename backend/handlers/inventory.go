@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"nexora-backend/config"
+	"nexora-backend/models"
+	"nexora-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GetStockMovements returns the stock ledger of a product, newest first (admin only)
+func GetStockMovements(c *gin.Context) {
+	productID := c.Param("id")
+
+	var product models.Product
+	if err := config.DB.Unscoped().First(&product, "id = ?", productID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	p := pageParams(c, 50)
+
+	query := config.DB.Model(&models.StockMovement{}).Where("product_id = ?", product.ID)
+	if variantID := c.Query("variant_id"); variantID != "" {
+		query = query.Where("variant_id = ?", variantID)
+	}
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var movements []models.StockMovement
+	if err := query.Order("created_at desc").Offset(p.Offset()).Limit(p.Limit).Find(&movements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock movements"})
+		return
+	}
+
+	response := pageResponse(p, "movements", movements, total)
+	response["product_id"] = product.ID
+	response["stock"] = product.Stock
+	c.JSON(http.StatusOK, response)
+}
+
+// AdjustStock records a manual stock change for a product or one of its variants (admin only)
+func AdjustStock(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var input struct {
+		VariantID string `json:"variant_id"`
+		Delta     int    `json:"delta" binding:"required"`
+		Reason    string `json:"reason"`
+		Note      string `json:"note"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reason := models.StockMovementReason(input.Reason)
+	if reason == "" {
+		reason = models.StockReasonAdminAdjustment
+	}
+	if reason != models.StockReasonAdminAdjustment && reason != models.StockReasonRestock {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason must be admin_adjustment or restock"})
+		return
+	}
+
+	change := services.StockChange{
+		ProductID: productID,
+		Delta:     input.Delta,
+		Reason:    reason,
+		Actor:     actorFromContext(c),
+		Note:      input.Note,
+	}
+	if input.VariantID != "" {
+		variantID, err := uuid.Parse(input.VariantID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+			return
+		}
+		change.VariantID = &variantID
+	}
+
+	var product models.Product
+	if err := config.DB.First(&product, "id = ?", productID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		return services.ApplyStockChange(tx, change)
+	})
+	if err != nil {
+		var stockErr *services.InsufficientStockError
+		if errors.As(err, &stockErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Adjustment would make stock negative"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
+		return
+	}
+
+	config.DB.Preload("Variants").First(&product, "id = ?", productID)
+	c.JSON(http.StatusOK, product)
+}
+
+// RebuildProductStock recomputes a product's stock from its movement ledger (admin only)
+func RebuildProductStock(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var rebuild *services.StockRebuild
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		rebuild, err = services.RebuildStock(tx, productID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rebuild stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rebuild)
+}
@@ -1,18 +1,21 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"math/rand"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
 	"nexora-backend/config"
 	"nexora-backend/models"
+	"nexora-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // GenerateOrderNumber creates a unique order number from name initials
@@ -34,14 +37,100 @@ func GenerateOrderNumber(name string) string {
 	return fmt.Sprintf("%s-%d", initials, randomNum)
 }
 
+// actorFromContext builds the status history actor from the authenticated user
+func actorFromContext(c *gin.Context) services.Actor {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		return services.Actor{Role: services.ActorGuest}
+	}
+	parsedUserID, err := uuid.Parse(userID.(string))
+	if err != nil {
+		return services.Actor{Role: services.ActorGuest}
+	}
+	role, _ := c.Get("role")
+	if role == "admin" {
+		return services.Actor{UserID: &parsedUserID, Role: services.ActorAdmin}
+	}
+	return services.Actor{UserID: &parsedUserID, Role: services.ActorCustomer}
+}
+
+// respondTransitionError maps order state machine errors to API responses
+func respondTransitionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order status"})
+	case errors.Is(err, services.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrStaleOrder):
+		c.JSON(http.StatusConflict, gin.H{"error": "Order was updated by someone else, please retry"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+	}
+}
+
+// respondStockError reports which product or variant could not be reserved.
+// Running out of stock is a conflict with other checkouts, hence 409.
+func respondStockError(c *gin.Context, err error) {
+	var stockErr *services.InsufficientStockError
+	if !errors.As(err, &stockErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reserve stock"})
+		return
+	}
+
+	response := gin.H{
+		"error":      stockErr.Error(),
+		"product_id": stockErr.ProductID,
+		"requested":  stockErr.Requested,
+	}
+	if stockErr.VariantID != nil {
+		response["variant_id"] = stockErr.VariantID
+		response["variant"] = stockErr.VariantInfo
+	}
+	c.JSON(http.StatusConflict, response)
+}
+
+// respondCheckoutError maps order placement errors to API responses
+func respondCheckoutError(c *gin.Context, err error) {
+	var stockErr *services.InsufficientStockError
+	switch {
+	case errors.As(err, &stockErr):
+		respondStockError(c, err)
+	case errors.Is(err, services.ErrUnknownCourier), errors.Is(err, services.ErrNoShippingZone),
+		errors.Is(err, services.ErrNoShippingRate):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCouponNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+	case errors.Is(err, services.ErrCouponUsageLimit), errors.Is(err, services.ErrCouponUserLimit):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCouponInactive), errors.Is(err, services.ErrCouponNotStarted),
+		errors.Is(err, services.ErrCouponExpired), errors.Is(err, services.ErrCouponMinSpend),
+		errors.Is(err, services.ErrCouponNotApplicable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+	}
+}
+
+// preloadStatusHistory loads the order timeline oldest first
+func preloadStatusHistory(db *gorm.DB) *gorm.DB {
+	return db.Order("created_at asc")
+}
+
+// preloadShipmentEvents loads courier tracking events oldest first
+func preloadShipmentEvents(db *gorm.DB) *gorm.DB {
+	return db.Order("time asc")
+}
+
 // CreateOrder creates a new order from the cart (logged-in user)
 func CreateOrder(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	parsedUserID, _ := uuid.Parse(userID.(string))
 
 	var input struct {
-		AddressID string `json:"address_id" binding:"required"`
-		Notes     string `json:"notes"`
+		AddressID  string `json:"address_id" binding:"required"`
+		Notes      string `json:"notes"`
+		CouponCode string `json:"coupon_code"`
+		Courier    string `json:"courier"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -68,7 +157,7 @@ func CreateOrder(c *gin.Context) {
 
 	// Get cart items
 	var cartItems []models.CartItem
-	if err := config.DB.Preload("Product").Preload("Variant").
+	if err := config.DB.Scopes(services.PreloadCartItems).
 		Where("user_id = ?", parsedUserID).Find(&cartItems).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
 		return
@@ -79,81 +168,37 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// Calculate totals and check stock
-	var subtotal float64
-	var orderItems []models.OrderItem
-
-	for _, item := range cartItems {
-		// Check stock
-		if item.Product.Stock < item.Quantity {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Insufficient stock for %s", item.Product.Name)})
-			return
-		}
-
-		price := item.Product.BasePrice
-		variantInfo := ""
-		if item.Variant != nil {
-			price += item.Variant.PriceModifier
-			variantInfo = item.Variant.Name + ": " + item.Variant.Value
-		}
-		itemSubtotal := price * float64(item.Quantity)
-		subtotal += itemSubtotal
-
-		orderItems = append(orderItems, models.OrderItem{
-			ProductID:   item.ProductID,
-			VariantID:   item.VariantID,
-			ProductName: item.Product.Name,
-			VariantInfo: variantInfo,
-			Price:       price,
-			Quantity:    item.Quantity,
-			Subtotal:    itemSubtotal,
-		})
+	if !checkCartBeforeCheckout(c, cartItems) {
+		return
 	}
 
-	shippingFee := 15000.0
-	if subtotal > 500000 {
-		shippingFee = 0
-	}
-	total := subtotal + shippingFee
+	// Build order lines (stock is reserved inside the transaction)
+	lines := services.CartLines(cartItems)
 
 	// Create order
 	order := models.Order{
 		OrderNumber: GenerateOrderNumber(user.Name),
 		UserID:      &parsedUserID,
 		AddressID:   &addressID,
-		Status:      models.OrderStatusPending,
-		Subtotal:    subtotal,
-		ShippingFee: shippingFee,
-		Total:       total,
 		Notes:       input.Notes,
 	}
 
 	tx := config.DB.Begin()
 
-	if err := tx.Create(&order).Error; err != nil {
+	if err := services.PlaceOrder(tx, services.Checkout{
+		Order:       &order,
+		Lines:       lines,
+		CouponCode:  input.CouponCode,
+		Courier:     input.Courier,
+		Destination: services.ShippingDestination{State: address.State, City: address.City, PostalCode: address.PostalCode},
+		Customer:    services.CouponCustomer{UserID: &parsedUserID},
+		Actor:       services.Actor{UserID: &parsedUserID, Role: services.ActorCustomer},
+	}); err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		respondCheckoutError(c, err)
 		return
 	}
 
-	// Create order items and reserve stock
-	for i := range orderItems {
-		orderItems[i].OrderID = order.ID
-		if err := tx.Create(&orderItems[i]).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order items"})
-			return
-		}
-
-		// Reserve stock
-		if err := tx.Model(&models.Product{}).Where("id = ?", orderItems[i].ProductID).
-			Update("stock", config.DB.Raw("stock - ?", orderItems[i].Quantity)).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reserve stock"})
-			return
-		}
-	}
-
 	// Clear cart
 	if err := tx.Where("user_id = ?", parsedUserID).Delete(&models.CartItem{}).Error; err != nil {
 		tx.Rollback()
@@ -161,7 +206,15 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
+	}
+
+	// Credit the abandoned cart email that brought the customer back, if any
+	if err := services.MarkCartRecoveryConverted(config.DB, &order); err != nil {
+		log.Printf("Failed to record cart recovery for order %s: %v", order.ID, err)
+	}
 
 	config.DB.Preload("Items").Preload("Address").First(&order, order.ID)
 	c.JSON(http.StatusCreated, order)
@@ -170,16 +223,17 @@ func CreateOrder(c *gin.Context) {
 // CreateGuestOrder creates an order for guest checkout
 func CreateGuestOrder(c *gin.Context) {
 	var input struct {
-		GuestEmail   string `json:"guest_email" binding:"required,email"`
-		GuestName    string `json:"guest_name" binding:"required"`
-		GuestPhone   string `json:"guest_phone" binding:"required"`
-		GuestAddress string `json:"guest_address" binding:"required"`
-		Notes        string `json:"notes"`
-		Items        []struct {
-			ProductID string `json:"product_id" binding:"required"`
-			VariantID string `json:"variant_id"`
-			Quantity  int    `json:"quantity" binding:"required,min=1"`
-		} `json:"items" binding:"required,min=1"`
+		GuestEmail      string              `json:"guest_email" binding:"required,email"`
+		GuestName       string              `json:"guest_name" binding:"required"`
+		GuestPhone      string              `json:"guest_phone" binding:"required"`
+		GuestAddress    string              `json:"guest_address" binding:"required"`
+		GuestCity       string              `json:"guest_city"`
+		GuestState      string              `json:"guest_state"`
+		GuestPostalCode string              `json:"guest_postal_code"`
+		Notes           string              `json:"notes"`
+		CouponCode      string              `json:"coupon_code"`
+		Courier         string              `json:"courier"`
+		Items           []checkoutItemInput `json:"items" binding:"omitempty,dive"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -187,111 +241,162 @@ func CreateGuestOrder(c *gin.Context) {
 		return
 	}
 
-	// Calculate totals and verify stock
-	var subtotal float64
-	var orderItems []models.OrderItem
-
-	for _, item := range input.Items {
-		productID, err := uuid.Parse(item.ProductID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+	// Build and validate order lines (stock is reserved inside the transaction).
+	// Without explicit items the guest's server cart is checked out.
+	var lines []services.CheckoutLine
+	token := cartToken(c)
+	if len(input.Items) > 0 {
+		var ok bool
+		if lines, ok = checkoutLinesFromItems(c, input.Items); !ok {
 			return
 		}
-
-		var product models.Product
-		if err := config.DB.First(&product, "id = ?", productID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		token = ""
+	} else if token != "" {
+		var cartItems []models.CartItem
+		if err := config.DB.Scopes(services.PreloadCartItems).
+			Where("cart_token = ? AND user_id IS NULL", token).Find(&cartItems).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
 			return
 		}
-
-		// Check stock
-		if product.Stock < item.Quantity {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Insufficient stock for %s", product.Name)})
+		if !checkCartBeforeCheckout(c, cartItems) {
 			return
 		}
-
-		price := product.BasePrice
-		variantInfo := ""
-		var variantID *uuid.UUID
-
-		if item.VariantID != "" {
-			parsedVariantID, err := uuid.Parse(item.VariantID)
-			if err == nil {
-				var variant models.ProductVariant
-				if config.DB.First(&variant, "id = ?", parsedVariantID).Error == nil {
-					price += variant.PriceModifier
-					variantInfo = variant.Name + ": " + variant.Value
-					variantID = &parsedVariantID
-				}
-			}
-		}
-
-		itemSubtotal := price * float64(item.Quantity)
-		subtotal += itemSubtotal
-
-		orderItems = append(orderItems, models.OrderItem{
-			ProductID:   productID,
-			VariantID:   variantID,
-			ProductName: product.Name,
-			VariantInfo: variantInfo,
-			Price:       price,
-			Quantity:    item.Quantity,
-			Subtotal:    itemSubtotal,
-		})
+		lines = services.CartLines(cartItems)
 	}
 
-	shippingFee := 15000.0
-	if subtotal > 500000 {
-		shippingFee = 0
+	if len(lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		return
 	}
-	total := subtotal + shippingFee
 
 	// Create order
 	order := models.Order{
-		OrderNumber:  GenerateOrderNumber(input.GuestName),
-		Status:       models.OrderStatusPending,
-		Subtotal:     subtotal,
-		ShippingFee:  shippingFee,
-		Total:        total,
-		Notes:        input.Notes,
-		GuestEmail:   input.GuestEmail,
-		GuestName:    input.GuestName,
-		GuestPhone:   input.GuestPhone,
-		GuestAddress: input.GuestAddress,
+		OrderNumber:     GenerateOrderNumber(input.GuestName),
+		Notes:           input.Notes,
+		GuestEmail:      input.GuestEmail,
+		GuestName:       input.GuestName,
+		GuestPhone:      input.GuestPhone,
+		GuestAddress:    input.GuestAddress,
+		GuestCity:       input.GuestCity,
+		GuestState:      input.GuestState,
+		GuestPostalCode: input.GuestPostalCode,
 	}
 
 	tx := config.DB.Begin()
 
-	if err := tx.Create(&order).Error; err != nil {
+	if err := services.PlaceOrder(tx, services.Checkout{
+		Order:       &order,
+		Lines:       lines,
+		CouponCode:  input.CouponCode,
+		Courier:     input.Courier,
+		Destination: services.ShippingDestination{State: input.GuestState, City: input.GuestCity, PostalCode: input.GuestPostalCode},
+		Customer:    services.CouponCustomer{GuestEmail: input.GuestEmail},
+		Actor:       services.Actor{Role: services.ActorGuest},
+	}); err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		respondCheckoutError(c, err)
 		return
 	}
 
-	// Create order items and reserve stock
-	for i := range orderItems {
-		orderItems[i].OrderID = order.ID
-		if err := tx.Create(&orderItems[i]).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order items"})
-			return
-		}
-
-		// Reserve stock
-		if err := tx.Model(&models.Product{}).Where("id = ?", orderItems[i].ProductID).
-			Update("stock", config.DB.Raw("stock - ?", orderItems[i].Quantity)).Error; err != nil {
+	// Clear the guest cart if it was checked out
+	if token != "" {
+		if err := tx.Where("cart_token = ? AND user_id IS NULL", token).Delete(&models.CartItem{}).Error; err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reserve stock"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
 			return
 		}
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
+	}
 
 	config.DB.Preload("Items").First(&order, order.ID)
 	c.JSON(http.StatusCreated, order)
 }
 
+// checkCartBeforeCheckout validates the cart against the catalog. If anything
+// changed since the customer last saw it the warnings are returned with 409 so
+// they can review the cart (and accept new prices), and ok is false.
+func checkCartBeforeCheckout(c *gin.Context, cartItems []models.CartItem) (ok bool) {
+	warnings, err := services.ValidateCart(config.DB, cartItems)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check cart"})
+		return false
+	}
+	if len(warnings) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Your cart has changed, please review it before checking out",
+			"warnings": warnings,
+		})
+		return false
+	}
+	return true
+}
+
+// checkoutItemInput is an item sent by clients that have no server cart
+type checkoutItemInput struct {
+	ProductID string `json:"product_id" binding:"required"`
+	VariantID string `json:"variant_id"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+}
+
+// checkoutLinesFromItems prices client supplied items from the catalog. On
+// failure the error response has been written and ok is false.
+func checkoutLinesFromItems(c *gin.Context, items []checkoutItemInput) (lines []services.CheckoutLine, ok bool) {
+	for _, item := range items {
+		productID, err := uuid.Parse(item.ProductID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return nil, false
+		}
+
+		var product models.Product
+		if err := config.DB.First(&product, "id = ?", productID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return nil, false
+		}
+
+		price := product.BasePrice
+		variantInfo := ""
+		var variantID *uuid.UUID
+		var variant *models.ProductVariant
+
+		if item.VariantID != "" {
+			parsedVariantID, err := uuid.Parse(item.VariantID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+				return nil, false
+			}
+			variant = &models.ProductVariant{}
+			if err := config.DB.First(variant, "id = ? AND product_id = ?", parsedVariantID, productID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Variant not found for %s", product.Name)})
+				return nil, false
+			}
+			price += variant.PriceModifier
+			variantInfo = variant.Name + ": " + variant.Value
+			variantID = &variant.ID
+		}
+
+		lines = append(lines, services.CheckoutLine{
+			Item: models.OrderItem{
+				ProductID:   productID,
+				VariantID:   variantID,
+				ProductName: product.Name,
+				VariantInfo: variantInfo,
+				Price:       price,
+				Quantity:    item.Quantity,
+				Subtotal:    price * float64(item.Quantity),
+			},
+			CategoryID: product.CategoryID,
+			Weight:     services.ItemWeight(product, variant),
+		})
+	}
+
+	return lines, true
+}
+
 // TrackOrder allows guest to track their order
 func TrackOrder(c *gin.Context) {
 	var input struct {
@@ -306,6 +411,7 @@ func TrackOrder(c *gin.Context) {
 
 	var order models.Order
 	if err := config.DB.Preload("Items.Product.Images").Preload("Payment").
+		Preload("StatusHistory", preloadStatusHistory).Preload("ShipmentEvents", preloadShipmentEvents).
 		Where("order_number = ? AND guest_email = ?", input.OrderNumber, input.Email).
 		First(&order).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
@@ -319,31 +425,39 @@ func TrackOrder(c *gin.Context) {
 func GetOrders(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset := (page - 1) * limit
+	p, err := paginate(c, 10)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
 
 	var orders []models.Order
-	var total int64
+	query := config.DB.Preload("Items.Product.Images").Preload("Payment").Where("orders.user_id = ?", userID)
+
+	if p.Cursor != nil {
+		if err := p.Apply(query, "orders", true).Find(&orders).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+			return
+		}
+		page, next, prev := cursorPage(p, orders, orderCursorKey)
+		c.JSON(http.StatusOK, cursorResponse(p, "orders", page, next, prev))
+		return
+	}
 
+	var total int64
 	config.DB.Model(&models.Order{}).Where("user_id = ?", userID).Count(&total)
 
-	if err := config.DB.Preload("Items.Product.Images").Preload("Payment").
-		Where("user_id = ?", userID).
-		Order("created_at desc").
-		Offset(offset).Limit(limit).
-		Find(&orders).Error; err != nil {
+	if err := p.Apply(query, "orders", true).Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"orders": orders,
-		"total":  total,
-		"page":   page,
-		"limit":  limit,
-		"pages":  (total + int64(limit) - 1) / int64(limit),
-	})
+	c.JSON(http.StatusOK, pageResponse(p, "orders", orders, total))
+}
+
+// orderCursorKey is the position of an order in a cursor paged listing
+func orderCursorKey(order models.Order) (time.Time, uuid.UUID) {
+	return order.CreatedAt, order.ID
 }
 
 // GetOrder returns a single order
@@ -353,6 +467,8 @@ func GetOrder(c *gin.Context) {
 
 	var order models.Order
 	query := config.DB.Preload("Items.Product.Images").Preload("Address").Preload("Payment").Preload("User").
+		Preload("StatusHistory", preloadStatusHistory).Preload("ShipmentEvents", preloadShipmentEvents).
+		Preload("Returns", preloadReturns).Preload("Returns.Items").Preload("Returns.History", preloadStatusHistory).
 		Where("id = ?", orderID)
 
 	// Non-admin can only see their own orders
@@ -385,65 +501,62 @@ func CancelOrder(c *gin.Context) {
 		return
 	}
 
+	actor := actorFromContext(c)
 	tx := config.DB.Begin()
 
-	// Restore stock
-	for _, item := range order.Items {
-		if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
-			Update("stock", config.DB.Raw("stock + ?", item.Quantity)).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore stock"})
-			return
-		}
+	// Cancel the order, restoring stock and releasing any coupon use
+	if err := services.CancelOrder(tx, &order, actor, "Cancelled by customer", models.StockReasonOrderCancelled); err != nil {
+		tx.Rollback()
+		respondTransitionError(c, err)
+		return
 	}
 
-	order.Status = models.OrderStatusCancelled
-	if err := tx.Save(&order).Error; err != nil {
-		tx.Rollback()
+	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
 		return
 	}
-
-	tx.Commit()
 	c.JSON(http.StatusOK, order)
 }
 
 // GetAllOrders returns all orders (admin only)
 func GetAllOrders(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
-	offset := (page - 1) * limit
+	p, err := paginate(c, 20)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
 
 	status := c.Query("status")
 
 	var orders []models.Order
-	var total int64
-
-	query := config.DB.Model(&models.Order{})
+	query := config.DB.Preload("User").Preload("Items.Product").Preload("Payment").Preload("Address")
 	if status != "" {
-		query = query.Where("status = ?", status)
+		query = query.Where("orders.status = ?", status)
+	}
+
+	if p.Cursor != nil {
+		if err := p.Apply(query, "orders", true).Find(&orders).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+			return
+		}
+		page, next, prev := cursorPage(p, orders, orderCursorKey)
+		c.JSON(http.StatusOK, cursorResponse(p, "orders", page, next, prev))
+		return
 	}
-	query.Count(&total)
 
-	query = config.DB.Preload("User").Preload("Items.Product").Preload("Payment").Preload("Address")
+	var total int64
+	countQuery := config.DB.Model(&models.Order{})
 	if status != "" {
-		query = query.Where("status = ?", status)
+		countQuery = countQuery.Where("status = ?", status)
 	}
+	countQuery.Count(&total)
 
-	if err := query.Order("created_at desc").
-		Offset(offset).Limit(limit).
-		Find(&orders).Error; err != nil {
+	if err := p.Apply(query, "orders", true).Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"orders": orders,
-		"total":  total,
-		"page":   page,
-		"limit":  limit,
-		"pages":  (total + int64(limit) - 1) / int64(limit),
-	})
+	c.JSON(http.StatusOK, pageResponse(p, "orders", orders, total))
 }
 
 // AdminGetOrderDetail returns full order details for admin
@@ -451,7 +564,9 @@ func AdminGetOrderDetail(c *gin.Context) {
 	orderID := c.Param("id")
 
 	var order models.Order
-	if err := config.DB.Preload("Items.Product.Images").Preload("Address").Preload("Payment").Preload("User").
+	if err := config.DB.Preload("Items.Product.Images").Preload("Address").Preload("Payment.Refunds").Preload("User").
+		Preload("StatusHistory", preloadStatusHistory).Preload("ShipmentEvents", preloadShipmentEvents).
+		Preload("Returns", preloadReturns).Preload("Returns.Items").Preload("Returns.History", preloadStatusHistory).
 		First(&order, "id = ?", orderID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
@@ -460,7 +575,7 @@ func AdminGetOrderDetail(c *gin.Context) {
 	c.JSON(http.StatusOK, order)
 }
 
-// UpdateOrderStatus updates order status (admin only)
+// UpdateOrderStatus moves an order to a new status (admin only)
 func UpdateOrderStatus(c *gin.Context) {
 	orderID := c.Param("id")
 
@@ -473,6 +588,8 @@ func UpdateOrderStatus(c *gin.Context) {
 	var input struct {
 		Status         string `json:"status" binding:"required"`
 		TrackingNumber string `json:"tracking_number"`
+		Courier        string `json:"courier"`
+		Reason         string `json:"reason"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -481,47 +598,73 @@ func UpdateOrderStatus(c *gin.Context) {
 	}
 
 	newStatus := models.OrderStatus(input.Status)
-	oldStatus := order.Status
-
-	// Validate tracking number is required for shipped status
-	if newStatus == models.OrderStatusShipped && input.TrackingNumber == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Tracking number is required for shipped orders"})
+	if !newStatus.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order status"})
 		return
 	}
 
-	// Update tracking number if provided
+	// Shipped orders need a tracking number and a courier it can be tracked with.
+	// The courier chosen at checkout is used unless another one is given.
+	courier := strings.ToLower(strings.TrimSpace(input.Courier))
+	if newStatus == models.OrderStatusShipped {
+		if input.TrackingNumber == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tracking number is required for shipped orders"})
+			return
+		}
+		if courier == "" {
+			courier = order.Courier
+		}
+		if courier == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Courier is required for shipped orders"})
+			return
+		}
+		if _, trackable := courierRegistry.Lookup(courier); !trackable && !services.IsSupportedCourier(courier) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported courier"})
+			return
+		}
+	}
+
+	// Update tracking number and courier if provided. They are set before the
+	// transition so the shipped email carries them.
+	shipping := map[string]interface{}{}
 	if input.TrackingNumber != "" {
 		order.TrackingNumber = input.TrackingNumber
+		shipping["tracking_number"] = input.TrackingNumber
+	}
+	if courier != "" && courier != order.Courier {
+		order.Courier = courier
+		shipping["courier"] = courier
 	}
 
-	// Set timestamps based on status
-	now := time.Now()
-	if newStatus == models.OrderStatusShipped && oldStatus != models.OrderStatusShipped {
-		order.ShippedAt = &now
+	actor := actorFromContext(c)
+	tx := config.DB.Begin()
+
+	// Cancelling also restores stock and releases any coupon use
+	var err error
+	if newStatus == models.OrderStatusCancelled {
+		err = services.CancelOrder(tx, &order, actor, input.Reason, models.StockReasonOrderCancelled)
+	} else {
+		err = services.TransitionOrder(tx, &order, newStatus, actor, input.Reason)
 	}
-	if newStatus == models.OrderStatusDelivered && oldStatus != models.OrderStatusDelivered {
-		order.DeliveredAt = &now
+	if err != nil {
+		tx.Rollback()
+		respondTransitionError(c, err)
+		return
 	}
 
-	// If cancelling, restore stock
-	if newStatus == models.OrderStatusCancelled && oldStatus != models.OrderStatusCancelled {
-		tx := config.DB.Begin()
-		for _, item := range order.Items {
-			if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
-				Update("stock", config.DB.Raw("stock + ?", item.Quantity)).Error; err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore stock"})
-				return
-			}
+	if len(shipping) > 0 {
+		if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).Updates(shipping).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+			return
 		}
-		tx.Commit()
 	}
 
-	order.Status = newStatus
-	if err := config.DB.Save(&order).Error; err != nil {
+	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
 		return
 	}
 
+	config.DB.Preload("Items").Preload("StatusHistory", preloadStatusHistory).First(&order, "id = ?", order.ID)
 	c.JSON(http.StatusOK, order)
 }
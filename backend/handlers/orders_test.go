@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nexora-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TestRespondCheckoutErrorOutOfStock checks that a checkout losing the race
+// for the last unit is answered with 409, see services.TestPlaceOrderLastUnit
+func TestRespondCheckoutErrorOutOfStock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	stockErr := &services.InsufficientStockError{ProductID: uuid.New(), ProductName: "Last Unit", Requested: 1}
+	for _, err := range []error{stockErr, fmt.Errorf("place order: %w", stockErr)} {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		respondCheckoutError(c, err)
+		if recorder.Code != http.StatusConflict {
+			t.Errorf("respondCheckoutError(%v) = %d, want %d", err, recorder.Code, http.StatusConflict)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxPageSize caps the limit of every listing
+const maxPageSize = 100
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pagination is how a listing is paged. Page mode uses page and limit with an
+// OFFSET and a total count. Cursor mode starts when a cursor is given (empty
+// for the first page) and walks (created_at, id) from there without counting,
+// so it stays fast and stable while rows are added.
+type pagination struct {
+	Page   int
+	Limit  int
+	Cursor *pageCursor // nil in page mode
+}
+
+// pageCursor is the position a cursor points at and which way it walks
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	Before    bool      `json:"b,omitempty"` // towards the start of the listing
+	first     bool      // the start of the listing, no position yet
+}
+
+// pageParams reads page and limit from the query string, capping the limit,
+// for listings that are only paged by page
+func pageParams(c *gin.Context, defaultLimit int) pagination {
+	p := pagination{Page: 1, Limit: defaultLimit}
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		p.Page = page
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		p.Limit = limit
+	}
+	if p.Limit > maxPageSize {
+		p.Limit = maxPageSize
+	}
+	return p
+}
+
+// paginate reads page, limit and cursor from the query string, capping the limit
+func paginate(c *gin.Context, defaultLimit int) (pagination, error) {
+	p := pageParams(c, defaultLimit)
+
+	token, ok := c.GetQuery("cursor")
+	if !ok {
+		return p, nil
+	}
+	p.Cursor = &pageCursor{first: true}
+	if token == "" {
+		return p, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return p, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, p.Cursor); err != nil || p.Cursor.ID == uuid.Nil {
+		return p, errInvalidCursor
+	}
+	p.Cursor.first = false
+	return p, nil
+}
+
+// Offset is the number of rows before the page in page mode
+func (p pagination) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// Pages is the number of pages total rows fill
+func (p pagination) Pages(total int64) int64 {
+	return (total + int64(p.Limit) - 1) / int64(p.Limit)
+}
+
+// Apply orders a query by (created_at, id) of table, newest first unless
+// desc is false, and limits it to the page. Cursor mode fetches one row more
+// than the limit, which cursorPage uses to tell whether there is another page.
+func (p pagination) Apply(query *gorm.DB, table string, desc bool) *gorm.DB {
+	if p.Cursor == nil {
+		return query.Clauses(keysetOrder(table, desc)).Offset(p.Offset()).Limit(p.Limit)
+	}
+
+	// Walking back towards the start reads the listing in reverse
+	forward := desc != p.Cursor.Before
+	if !p.Cursor.first {
+		op := ">"
+		if forward {
+			op = "<"
+		}
+		query = query.Where("("+table+".created_at, "+table+".id) "+op+" (?, ?)", p.Cursor.CreatedAt, p.Cursor.ID)
+	}
+	return query.Clauses(keysetOrder(table, forward)).Limit(p.Limit + 1)
+}
+
+// keysetOrder orders by (created_at, id) of table
+func keysetOrder(table string, desc bool) clause.OrderBy {
+	return clause.OrderBy{Columns: []clause.OrderByColumn{
+		{Column: clause.Column{Table: table, Name: "created_at"}, Desc: desc},
+		{Column: clause.Column{Table: table, Name: "id"}, Desc: desc},
+	}}
+}
+
+// encode turns a cursor into the opaque token clients pass back
+func (cursor pageCursor) encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursorPage trims the extra row Apply fetched, puts a page read in reverse
+// back in order and returns the cursors to the pages after and before it.
+// A cursor is empty when there is no such page.
+func cursorPage[T any](p pagination, items []T, key func(T) (time.Time, uuid.UUID)) (page []T, next, prev string) {
+	more := len(items) > p.Limit
+	if more {
+		items = items[:p.Limit]
+	}
+	if p.Cursor.Before {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if len(items) == 0 {
+		return items, "", ""
+	}
+
+	// Coming from a cursor means there is a page on the side it came from
+	hasNext, hasPrev := more, !p.Cursor.first
+	if p.Cursor.Before {
+		hasNext, hasPrev = !p.Cursor.first, more
+	}
+	if hasNext {
+		createdAt, id := key(items[len(items)-1])
+		next = pageCursor{CreatedAt: createdAt, ID: id}.encode()
+	}
+	if hasPrev {
+		createdAt, id := key(items[0])
+		prev = pageCursor{CreatedAt: createdAt, ID: id, Before: true}.encode()
+	}
+	return items, next, prev
+}
+
+// cursorResponse is the response of a page in cursor mode; a missing cursor is null
+func cursorResponse(p pagination, name string, items interface{}, next, prev string) gin.H {
+	response := gin.H{
+		name:          items,
+		"limit":       p.Limit,
+		"next_cursor": nil,
+		"prev_cursor": nil,
+	}
+	if next != "" {
+		response["next_cursor"] = next
+	}
+	if prev != "" {
+		response["prev_cursor"] = prev
+	}
+	return response
+}
+
+// pageResponse is the response of a page in page mode
+func pageResponse(p pagination, name string, items interface{}, total int64) gin.H {
+	return gin.H{
+		name:    items,
+		"total": total,
+		"page":  p.Page,
+		"limit": p.Limit,
+		"pages": p.Pages(total),
+	}
+}
@@ -1,50 +1,30 @@
 package handlers
 
 import (
-	"bytes"
-	"crypto/sha512"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"time"
 
 	"nexora-backend/config"
 	"nexora-backend/models"
+	"nexora-backend/services"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
-type MidtransChargeRequest struct {
-	TransactionDetails struct {
-		OrderID     string  `json:"order_id"`
-		GrossAmount float64 `json:"gross_amount"`
-	} `json:"transaction_details"`
-	CustomerDetails struct {
-		FirstName string `json:"first_name"`
-		Email     string `json:"email"`
-		Phone     string `json:"phone"`
-	} `json:"customer_details"`
-}
+var paymentGateway services.PaymentGateway
 
-type MidtransSnapResponse struct {
-	Token       string `json:"token"`
-	RedirectURL string `json:"redirect_url"`
+// InitPaymentGateway sets the payment provider used by the payment handlers
+func InitPaymentGateway(gateway services.PaymentGateway) {
+	paymentGateway = gateway
 }
 
-// CreatePayment creates a payment for an order using Midtrans Snap
-func CreatePayment(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	orderID := c.Param("order_id")
-
-	var order models.Order
-	if err := config.DB.Preload("User").Where("id = ? AND user_id = ?", orderID, userID).First(&order).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
-		return
-	}
-
+// createOrderPayment creates a gateway charge for a pending order and stores the payment
+func createOrderPayment(c *gin.Context, order models.Order, charge services.ChargeRequest) {
 	if order.Status != models.OrderStatusPending {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment already processed or order cancelled"})
 		return
@@ -57,73 +37,16 @@ func CreatePayment(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{
 				"snap_token":   existingPayment.SnapToken,
 				"redirect_url": existingPayment.RedirectURL,
+				"provider":     paymentGateway.Name(),
 			})
 			return
 		}
 	}
 
-	// Create Midtrans Snap token
-	midtransOrderID := fmt.Sprintf("NEXORA-%s-%d", order.ID.String()[:8], time.Now().Unix())
-
-	snapRequest := map[string]interface{}{
-		"transaction_details": map[string]interface{}{
-			"order_id":     midtransOrderID,
-			"gross_amount": int(order.Total),
-		},
-		"customer_details": map[string]interface{}{
-			"first_name": order.User.Name,
-			"email":      order.User.Email,
-		},
-		"callbacks": map[string]interface{}{
-			"finish": config.AppConfig.FrontendURL + "/orders/" + order.ID.String(),
-		},
-	}
-
-	jsonBody, _ := json.Marshal(snapRequest)
-
-	// Determine Midtrans URL based on environment
-	midtransURL := "https://app.sandbox.midtrans.com/snap/v1/transactions"
-	if config.AppConfig.MidtransIsProduction {
-		midtransURL = "https://app.midtrans.com/snap/v1/transactions"
-	}
-
-	req, _ := http.NewRequest("POST", midtransURL, bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.SetBasicAuth(config.AppConfig.MidtransServerKey, "")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	charge.Amount = order.Total
+	result, err := paymentGateway.CreateCharge(c.Request.Context(), charge)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to payment gateway"})
-		return
-	}
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	resp.Body.Close() // Close original body
-
-	// Create new reader for decoding
-	resp.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-	var snapResp MidtransSnapResponse
-	if err := json.NewDecoder(resp.Body).Decode(&snapResp); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse payment response"})
-		return
-	}
-
-	if snapResp.Token == "" {
-		// Log the raw body to see the error message
-		fmt.Printf("Midtrans Error Body: %s\n", string(bodyBytes))
-
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment token. Check server logs."})
-		return
-	}
-
-	if snapResp.Token == "" {
-		// Debug logging
-		fmt.Printf("Midtrans Error: %+v\n", snapResp)
-		// Try to read full body for error details
-		// (In a real scenario, we should have read the body into a buffer first)
-
+		log.Printf("Failed to create %s charge for order %s: %v", paymentGateway.Name(), order.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment token. Check server logs."})
 		return
 	}
@@ -131,11 +54,11 @@ func CreatePayment(c *gin.Context) {
 	// Create payment record
 	payment := models.Payment{
 		OrderID:     order.ID,
-		MidtransID:  midtransOrderID,
+		MidtransID:  charge.Reference,
 		Status:      models.PaymentStatusPending,
 		Amount:      order.Total,
-		SnapToken:   snapResp.Token,
-		RedirectURL: snapResp.RedirectURL,
+		SnapToken:   result.Token,
+		RedirectURL: result.RedirectURL,
 	}
 
 	if err := config.DB.Create(&payment).Error; err != nil {
@@ -144,187 +67,86 @@ func CreatePayment(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"snap_token":   snapResp.Token,
-		"redirect_url": snapResp.RedirectURL,
+		"snap_token":   result.Token,
+		"redirect_url": result.RedirectURL,
+		"provider":     paymentGateway.Name(),
 	})
 }
 
-// CreateGuestPayment creates a payment for a guest order
-func CreateGuestPayment(c *gin.Context) {
+// CreatePayment creates a payment for an order through the payment gateway
+func CreatePayment(c *gin.Context) {
+	userID, _ := c.Get("user_id")
 	orderID := c.Param("order_id")
 
 	var order models.Order
-	if err := config.DB.Where("id = ? AND user_id IS NULL", orderID).First(&order).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Guest order not found"})
-		return
-	}
-
-	if order.Status != models.OrderStatusPending {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment already processed or order cancelled"})
-		return
-	}
-
-	// Check if payment already exists
-	var existingPayment models.Payment
-	if err := config.DB.Where("order_id = ? AND status != ?", order.ID, models.PaymentStatusFailed).First(&existingPayment).Error; err == nil {
-		if existingPayment.Status == models.PaymentStatusPending && existingPayment.SnapToken != "" {
-			c.JSON(http.StatusOK, gin.H{
-				"snap_token":   existingPayment.SnapToken,
-				"redirect_url": existingPayment.RedirectURL,
-			})
-			return
-		}
-	}
-
-	// Create Midtrans Snap token
-	midtransOrderID := fmt.Sprintf("NEXORA-GUEST-%s-%d", order.ID.String()[:8], time.Now().Unix())
-
-	snapRequest := map[string]interface{}{
-		"transaction_details": map[string]interface{}{
-			"order_id":     midtransOrderID,
-			"gross_amount": int(order.Total),
-		},
-		"customer_details": map[string]interface{}{
-			"first_name": order.GuestName,
-			"email":      order.GuestEmail,
-			"phone":      order.GuestPhone,
-		},
-		"callbacks": map[string]interface{}{
-			"finish": config.AppConfig.FrontendURL + "/track-order?order=" + order.OrderNumber + "&email=" + order.GuestEmail,
-		},
-	}
-
-	jsonBody, _ := json.Marshal(snapRequest)
-
-	// Determine Midtrans URL based on environment
-	midtransURL := "https://app.sandbox.midtrans.com/snap/v1/transactions"
-	if config.AppConfig.MidtransIsProduction {
-		midtransURL = "https://app.midtrans.com/snap/v1/transactions"
-	}
-
-	req, _ := http.NewRequest("POST", midtransURL, bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.SetBasicAuth(config.AppConfig.MidtransServerKey, "")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to payment gateway"})
-		return
-	}
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	resp.Body.Close()
-
-	resp.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-	var snapResp MidtransSnapResponse
-	if err := json.NewDecoder(resp.Body).Decode(&snapResp); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse payment response"})
+	if err := config.DB.Preload("User").Where("id = ? AND user_id = ?", orderID, userID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
 
-	if snapResp.Token == "" {
-		fmt.Printf("Midtrans Guest Error Body: %s\n", string(bodyBytes))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment token"})
-		return
-	}
+	createOrderPayment(c, order, services.ChargeRequest{
+		Reference:     fmt.Sprintf("NEXORA-%s-%d", order.ID.String()[:8], time.Now().Unix()),
+		CustomerName:  order.User.Name,
+		CustomerEmail: order.User.Email,
+		FinishURL:     config.AppConfig.FrontendURL + "/orders/" + order.ID.String(),
+	})
+}
 
-	// Create payment record
-	payment := models.Payment{
-		OrderID:     order.ID,
-		MidtransID:  midtransOrderID,
-		Status:      models.PaymentStatusPending,
-		Amount:      order.Total,
-		SnapToken:   snapResp.Token,
-		RedirectURL: snapResp.RedirectURL,
-	}
+// CreateGuestPayment creates a payment for a guest order
+func CreateGuestPayment(c *gin.Context) {
+	orderID := c.Param("order_id")
 
-	if err := config.DB.Create(&payment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payment"})
+	var order models.Order
+	if err := config.DB.Where("id = ? AND user_id IS NULL", orderID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest order not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"snap_token":   snapResp.Token,
-		"redirect_url": snapResp.RedirectURL,
+	createOrderPayment(c, order, services.ChargeRequest{
+		Reference:     fmt.Sprintf("NEXORA-GUEST-%s-%d", order.ID.String()[:8], time.Now().Unix()),
+		CustomerName:  order.GuestName,
+		CustomerEmail: order.GuestEmail,
+		CustomerPhone: order.GuestPhone,
+		FinishURL:     config.AppConfig.FrontendURL + "/track-order?order=" + order.OrderNumber + "&email=" + order.GuestEmail,
 	})
 }
 
-// PaymentNotification handles Midtrans webhook notifications
+// PaymentNotification handles payment gateway webhook notifications
 func PaymentNotification(c *gin.Context) {
-	var notification map[string]interface{}
-	if err := c.ShouldBindJSON(&notification); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	orderID := notification["order_id"].(string)
-	statusCode := notification["status_code"].(string)
-	grossAmount := notification["gross_amount"].(string)
-	signatureKey := notification["signature_key"].(string)
-	transactionStatus := notification["transaction_status"].(string)
-	paymentType := ""
-	if pt, ok := notification["payment_type"].(string); ok {
-		paymentType = pt
-	}
-
-	// Verify signature
-	input := orderID + statusCode + grossAmount + config.AppConfig.MidtransServerKey
-	hash := sha512.Sum512([]byte(input))
-	expectedSignature := hex.EncodeToString(hash[:])
-
-	if signatureKey != expectedSignature {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid signature"})
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read notification"})
 		return
 	}
 
-	// Find payment
-	var payment models.Payment
-	if err := config.DB.Where("midtrans_id = ?", orderID).First(&payment).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+	// Every notification is stored, including ones that fail verification
+	txn, err := paymentGateway.VerifyNotification(body)
+	record := services.RecordNotification(config.DB, services.NotificationSourceWebhook, body, txn, err)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSignature) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid signature"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Update payment status
-	switch transactionStatus {
-	case "capture", "settlement":
-		payment.Status = models.PaymentStatusSuccess
-		now := time.Now()
-		payment.PaidAt = &now
-		payment.Method = paymentType
-
-		// Update order status to paid (admin will approve to set processing)
-		config.DB.Model(&models.Order{}).Where("id = ?", payment.OrderID).Update("status", models.OrderStatusPaid)
-
-	case "deny", "cancel":
-		payment.Status = models.PaymentStatusFailed
-		// Restore stock
-		var orderItems []models.OrderItem
-		config.DB.Where("order_id = ?", payment.OrderID).Find(&orderItems)
-		for _, item := range orderItems {
-			config.DB.Model(&models.Product{}).Where("id = ?", item.ProductID).
-				Update("stock", config.DB.Raw("stock + ?", item.Quantity))
-		}
-		config.DB.Model(&models.Order{}).Where("id = ?", payment.OrderID).Update("status", models.OrderStatusCancelled)
-
-	case "expire":
-		payment.Status = models.PaymentStatusExpired
-		// Restore stock
-		var orderItems []models.OrderItem
-		config.DB.Where("order_id = ?", payment.OrderID).Find(&orderItems)
-		for _, item := range orderItems {
-			config.DB.Model(&models.Product{}).Where("id = ?", item.ProductID).
-				Update("stock", config.DB.Raw("stock + ?", item.Quantity))
+	if _, err := services.ApplyNotification(config.DB, record, txn); err != nil {
+		if errors.Is(err, services.ErrPaymentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+			return
 		}
-		config.DB.Model(&models.Order{}).Where("id = ?", payment.OrderID).Update("status", models.OrderStatusCancelled)
+		log.Printf("Failed to apply payment notification for %s: %v", txn.Reference, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process notification"})
+		return
 	}
 
-	config.DB.Save(&payment)
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "outcome": record.Outcome})
 }
 
-// GetPaymentStatus returns the payment status for an order
+// GetPaymentStatus returns the payment status for an order. Pending payments are
+// refreshed from the gateway first, so the result does not depend on the webhook
+// having reached us.
 func GetPaymentStatus(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	orderID := c.Param("order_id")
@@ -341,76 +163,121 @@ func GetPaymentStatus(c *gin.Context) {
 		return
 	}
 
+	if payment.Status == models.PaymentStatusPending {
+		txn, err := paymentGateway.QueryStatus(c.Request.Context(), payment.MidtransID)
+		if err == nil {
+			if updated, _, err := services.ApplyTransaction(config.DB, services.NotificationSourceStatusQuery, txn); err == nil {
+				payment = *updated
+			} else {
+				log.Printf("Failed to apply payment status for %s: %v", payment.MidtransID, err)
+			}
+		} else if !errors.Is(err, services.ErrTransactionNotFound) {
+			log.Printf("Failed to query payment status for %s: %v", payment.MidtransID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, payment)
 }
 
-// SimulatePayment simulates a successful payment (for sandbox testing)
-func SimulatePayment(c *gin.Context) {
-	if config.AppConfig.MidtransIsProduction {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Simulation not available in production"})
+// FakePaymentPage completes a fake gateway transaction and sends the customer
+// back to the store. It stands in for the hosted Snap page in development.
+func FakePaymentPage(c *gin.Context) {
+	fake, ok := paymentGateway.(*services.FakeGateway)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fake payment provider is not enabled"})
 		return
 	}
 
-	orderID := c.Param("order_id")
-	parsedOrderID, err := uuid.Parse(orderID)
+	status := c.DefaultQuery("status", services.TransactionSettlement)
+	body, finishURL, err := fake.Complete(c.Param("reference"), status)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		if errors.Is(err, services.ErrTransactionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var payment models.Payment
-	if err := config.DB.Where("order_id = ?", parsedOrderID).First(&payment).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+	// Deliver the notification through the same path as a real webhook
+	txn, err := fake.VerifyNotification(body)
+	record := services.RecordNotification(config.DB, services.NotificationSourceFake, body, txn, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := services.ApplyNotification(config.DB, record, txn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payment"})
 		return
 	}
 
-	payment.Status = models.PaymentStatusSuccess
-	payment.Method = "simulation"
-	now := time.Now()
-	payment.PaidAt = &now
+	c.Redirect(http.StatusSeeOther, finishURL)
+}
 
-	config.DB.Save(&payment)
-	// Set to paid (admin will approve to set processing)
-	config.DB.Model(&models.Order{}).Where("id = ?", parsedOrderID).Update("status", models.OrderStatusPaid)
+// GetPaymentNotifications returns stored gateway notifications, newest first,
+// filterable by reference and outcome (admin only)
+func GetPaymentNotifications(c *gin.Context) {
+	p := pageParams(c, 50)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Payment simulated successfully"})
-}
+	query := config.DB.Model(&models.PaymentNotification{})
+	if reference := c.Query("reference"); reference != "" {
+		query = query.Where("reference = ?", reference)
+	}
+	if outcome := c.Query("outcome"); outcome != "" {
+		query = query.Where("outcome = ?", outcome)
+	}
+
+	var total int64
+	query.Count(&total)
 
-// SimulateGuestPayment simulates a successful payment for guest orders (for sandbox testing)
-func SimulateGuestPayment(c *gin.Context) {
-	if config.AppConfig.MidtransIsProduction {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Simulation not available in production"})
+	var notifications []models.PaymentNotification
+	if err := query.Order("created_at desc").Offset(p.Offset()).Limit(p.Limit).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
 		return
 	}
 
-	orderID := c.Param("order_id")
-	parsedOrderID, err := uuid.Parse(orderID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+	c.JSON(http.StatusOK, pageResponse(p, "notifications", notifications, total))
+}
+
+// ReplayPaymentNotification processes a stored notification again. Webhook
+// payloads are verified again first; updates already applied are recorded as
+// duplicates and change nothing. (admin only)
+func ReplayPaymentNotification(c *gin.Context) {
+	var stored models.PaymentNotification
+	if err := config.DB.First(&stored, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
 		return
 	}
 
-	// Ensure it's a guest order (no user_id)
-	var order models.Order
-	if err := config.DB.Where("id = ? AND user_id IS NULL", parsedOrderID).First(&order).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Guest order not found"})
+	if stored.Source == services.NotificationSourceReplay {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Replay the original notification instead"})
 		return
 	}
 
-	var payment models.Payment
-	if err := config.DB.Where("order_id = ?", parsedOrderID).First(&payment).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+	var txn *services.GatewayTransaction
+	var err error
+	// Status query results are stored as we decoded them and carry no signature
+	if stored.Source == services.NotificationSourceStatusQuery || stored.Source == services.NotificationSourceReconcile {
+		txn = &services.GatewayTransaction{}
+		err = json.Unmarshal([]byte(stored.Payload), txn)
+	} else {
+		txn, err = paymentGateway.VerifyNotification([]byte(stored.Payload))
+	}
+	record := services.RecordNotification(config.DB, services.NotificationSourceReplay, []byte(stored.Payload), txn, err)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "notification": record})
 		return
 	}
 
-	payment.Status = models.PaymentStatusSuccess
-	payment.Method = "simulation"
-	now := time.Now()
-	payment.PaidAt = &now
-
-	config.DB.Save(&payment)
-	// Set to paid (admin will approve to set processing)
-	config.DB.Model(&models.Order{}).Where("id = ?", parsedOrderID).Update("status", models.OrderStatusPaid)
+	if _, err := services.ApplyNotification(config.DB, record, txn); err != nil {
+		if errors.Is(err, services.ErrPaymentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found", "notification": record})
+			return
+		}
+		log.Printf("Failed to replay payment notification %s: %v", stored.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process notification", "notification": record})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Guest payment simulated successfully", "order_id": order.ID, "order_number": order.OrderNumber})
+	c.JSON(http.StatusOK, record)
 }
@@ -1,81 +1,214 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"nexora-backend/config"
 	"nexora-backend/models"
+	"nexora-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gosimple/slug"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// GetProducts returns all products with filtering and pagination
-func GetProducts(c *gin.Context) {
-	var products []models.Product
-	query := config.DB.Preload("Category").Preload("Images")
-
-	// Search
-	if search := c.Query("search"); search != "" {
-		query = query.Where("name ILIKE ? OR description ILIKE ?", "%"+search+"%", "%"+search+"%")
-	}
-
-	// Category filter
-	if categoryID := c.Query("category"); categoryID != "" {
-		query = query.Where("category_id = ?", categoryID)
+// productFilter reads the product listing filters from the query string.
+// Facets take several values, repeated or comma separated:
+// ?category=<id>,<id>&attr[Size]=XL,L&attr[Color]=Red&in_stock=true&min_rating=4
+func productFilter(c *gin.Context) (services.ProductFilter, string) {
+	filter := services.ProductFilter{
+		Search:          strings.TrimSpace(c.Query("search")),
+		Attributes:      map[string][]string{},
+		InStock:         c.Query("in_stock") == "true",
+		FeaturedOnly:    c.Query("featured") == "true",
+		IncludeInactive: c.Query("active") == "false",
+	}
+	if filter.Search != "" {
+		filter.SearchMode = services.SearchModeFullText
+	}
+
+	for _, value := range splitQueryValues(c.QueryArray("category")) {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return filter, "Invalid category " + value
+		}
+		filter.CategoryIDs = append(filter.CategoryIDs, id)
 	}
 
-	// Active only
-	if c.Query("active") != "false" {
-		query = query.Where("is_active = ?", true)
+	for name, values := range c.QueryMap("attr") {
+		if name = strings.TrimSpace(name); name != "" {
+			filter.Attributes[name] = splitQueryValues([]string{values})
+		}
 	}
 
-	// Featured filter
-	if c.Query("featured") == "true" {
-		query = query.Where("is_featured = ?", true)
+	if minRating := c.Query("min_rating"); minRating != "" {
+		rating, err := strconv.ParseFloat(minRating, 64)
+		if err != nil || rating < 0 || rating > 5 {
+			return filter, "min_rating must be between 0 and 5"
+		}
+		filter.MinRating = rating
 	}
 
-	// Price range
+	// Price range, against variant prices where the product has variants
 	if minPrice := c.Query("min_price"); minPrice != "" {
 		if price, err := strconv.ParseFloat(minPrice, 64); err == nil {
-			query = query.Where("base_price >= ?", price)
+			filter.MinPrice = &price
 		}
 	}
 	if maxPrice := c.Query("max_price"); maxPrice != "" {
 		if price, err := strconv.ParseFloat(maxPrice, 64); err == nil {
-			query = query.Where("base_price <= ?", price)
+			filter.MaxPrice = &price
 		}
 	}
 
-	// Sorting
-	sortBy := c.DefaultQuery("sort", "created_at")
-	order := c.DefaultQuery("order", "desc")
-	query = query.Order(sortBy + " " + order)
+	return filter, ""
+}
 
-	// Pagination
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "12"))
-	offset := (page - 1) * limit
+// splitQueryValues splits comma separated query values, dropping empty ones
+func splitQueryValues(values []string) []string {
+	var split []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				split = append(split, part)
+			}
+		}
+	}
+	return split
+}
 
-	var total int64
-	config.DB.Model(&models.Product{}).Where("is_active = ?", true).Count(&total)
+// GetProducts returns all products with filtering, facet counts and pagination
+func GetProducts(c *gin.Context) {
+	filter, problem := productFilter(c)
+	if problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return
+	}
 
-	query = query.Offset(offset).Limit(limit)
+	// Sorting by a named key; searches are ordered by relevance unless a sort is asked for
+	sortKey, sortDirection := c.Query("sort"), c.Query("order")
+	_, err := services.ProductSortOrder(filter, sortKey, sortDirection)
+	if errors.Is(err, services.ErrUnknownSort) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Unknown sort " + sortKey,
+			"sort_keys": services.ProductSortKeys,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := query.Find(&products).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+	p, err := paginate(c, 12)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	// Cursors walk (created_at, id), so they only follow the newest sort
+	if p.Cursor != nil && sortKey != services.ProductSortNewest && (sortKey != "" || filter.Search != "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cursor pagination only supports the newest sort"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"products": products,
-		"total":    total,
-		"page":     page,
-		"limit":    limit,
-		"pages":    (total + int64(limit) - 1) / int64(limit),
+	// Search runs full text first and falls back to fuzzy name matching for
+	// typos when the listing is empty. The fallback's similarity threshold is
+	// set for the transaction, so every query of the listing runs in it.
+	var products []models.Product
+	var response gin.H
+	failure := "Failed to fetch products"
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if p.Cursor != nil {
+			find := func() error {
+				return p.Apply(filter.Apply(tx.Model(&models.Product{})), "products", sortDirection != "asc").
+					Preload("Category").Preload("Images").Find(&products).Error
+			}
+			if err := find(); err != nil {
+				return err
+			}
+			if len(products) == 0 && p.Cursor.first {
+				fuzzy, err := filter.FallBackToFuzzySearch(tx)
+				if err != nil {
+					return err
+				}
+				if fuzzy {
+					if err := find(); err != nil {
+						return err
+					}
+				}
+			}
+			var next, prev string
+			products, next, prev = cursorPage(p, products, func(product models.Product) (time.Time, uuid.UUID) {
+				return product.CreatedAt, product.ID
+			})
+			response = cursorResponse(p, "products", products, next, prev)
+		} else {
+			// Count what the filters let through, not the whole catalog
+			var total int64
+			count := func() error {
+				return filter.Apply(tx.Model(&models.Product{})).Count(&total).Error
+			}
+			if err := count(); err != nil {
+				return err
+			}
+			if total == 0 {
+				fuzzy, err := filter.FallBackToFuzzySearch(tx)
+				if err != nil {
+					return err
+				}
+				if fuzzy {
+					if err := count(); err != nil {
+						return err
+					}
+				}
+			}
+
+			sortOrder, err := services.ProductSortOrder(filter, sortKey, sortDirection)
+			if err != nil {
+				return err
+			}
+			if err := filter.Apply(tx.Model(&models.Product{})).Clauses(clause.OrderBy{Expression: sortOrder}).
+				Preload("Category").Preload("Images").Offset(p.Offset()).Limit(p.Limit).
+				Find(&products).Error; err != nil {
+				return err
+			}
+			response = pageResponse(p, "products", products, total)
+		}
+
+		if filter.Search != "" {
+			response["search_mode"] = filter.SearchMode
+			if filter.SearchMode == services.SearchModeFullText {
+				ids := make([]uuid.UUID, len(products))
+				for i, product := range products {
+					ids[i] = product.ID
+				}
+				response["highlights"] = services.SearchHighlights(tx, filter.Search, ids)
+			}
+		}
+
+		// Facet counts for a filter sidebar; clients that don't show one can skip them
+		if c.Query("facets") != "false" {
+			facets, err := services.ProductFacetCounts(tx, filter)
+			if err != nil {
+				failure = "Failed to count product facets"
+				return err
+			}
+			response["facets"] = facets
+		}
+		return nil
 	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // GetProduct returns a single product by slug or ID
@@ -115,6 +248,7 @@ func CreateProduct(c *gin.Context) {
 		BasePrice   float64  `json:"base_price" binding:"required"`
 		CategoryID  string   `json:"category_id"`
 		Stock       int      `json:"stock"`
+		Weight      int      `json:"weight"` // grams
 		IsActive    bool     `json:"is_active"`
 		IsFeatured  bool     `json:"is_featured"`
 		Images      []string `json:"images"`
@@ -125,12 +259,21 @@ func CreateProduct(c *gin.Context) {
 		return
 	}
 
+	if input.Stock < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot be negative"})
+		return
+	}
+	if input.Weight < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Weight cannot be negative"})
+		return
+	}
+
 	product := models.Product{
 		Name:        input.Name,
 		Slug:        slug.Make(input.Name),
 		Description: input.Description,
 		BasePrice:   input.BasePrice,
-		Stock:       input.Stock,
+		Weight:      input.Weight,
 		IsActive:    input.IsActive,
 		IsFeatured:  input.IsFeatured,
 	}
@@ -141,7 +284,34 @@ func CreateProduct(c *gin.Context) {
 		}
 	}
 
-	if err := config.DB.Create(&product).Error; err != nil {
+	tx := config.DB.Begin()
+
+	if err := tx.Create(&product).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+		return
+	}
+
+	// Initial stock goes through the ledger like any other stock change
+	if err := services.ApplyStockChange(tx, services.StockChange{
+		ProductID: product.ID,
+		Delta:     input.Stock,
+		Reason:    models.StockReasonRestock,
+		Actor:     actorFromContext(c),
+		Note:      "Initial stock",
+	}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+		return
+	}
+
+	if err := services.PublishEvent(tx, services.EventProductCreated, product.ID, services.NewProductEvent(&product)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
 		return
 	}
@@ -176,7 +346,8 @@ func UpdateProduct(c *gin.Context) {
 		Description string   `json:"description"`
 		BasePrice   float64  `json:"base_price"`
 		CategoryID  string   `json:"category_id"`
-		Stock       int      `json:"stock"`
+		Stock       *int     `json:"stock"`
+		Weight      *int     `json:"weight"` // grams
 		IsActive    *bool    `json:"is_active"`
 		IsFeatured  *bool    `json:"is_featured"`
 		Images      []string `json:"images"`
@@ -202,8 +373,16 @@ func UpdateProduct(c *gin.Context) {
 			product.CategoryID = catID
 		}
 	}
-	if input.Stock >= 0 {
-		product.Stock = input.Stock
+	if input.Stock != nil && *input.Stock < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot be negative"})
+		return
+	}
+	if input.Weight != nil {
+		if *input.Weight < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Weight cannot be negative"})
+			return
+		}
+		product.Weight = *input.Weight
 	}
 	if input.IsActive != nil {
 		product.IsActive = *input.IsActive
@@ -212,7 +391,34 @@ func UpdateProduct(c *gin.Context) {
 		product.IsFeatured = *input.IsFeatured
 	}
 
-	if err := config.DB.Save(&product).Error; err != nil {
+	tx := config.DB.Begin()
+
+	// Stock is never written from the loaded row, so concurrent checkouts are not overwritten
+	if err := tx.Omit("stock").Save(&product).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		return
+	}
+
+	if err := services.PublishEvent(tx, services.EventProductUpdated, product.ID, services.NewProductEvent(&product)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		return
+	}
+
+	if input.Stock != nil {
+		if err := services.SetStock(tx, product.ID, nil, *input.Stock, models.StockReasonAdminAdjustment, actorFromContext(c), "Product update"); err != nil {
+			tx.Rollback()
+			if errors.Is(err, services.ErrVariantStockRequired) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Product has variants; set the stock of each variant"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"nexora-backend/config"
+	"nexora-backend/models"
+	"nexora-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOrderRefunds returns the refunds issued for an order, newest first (admin only)
+func GetOrderRefunds(c *gin.Context) {
+	orderID := c.Param("id")
+
+	var order models.Order
+	if err := config.DB.First(&order, "id = ?", orderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var refunds []models.Refund
+	if err := config.DB.Where("order_id = ?", order.ID).Order("created_at desc").Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, refunds)
+}
+
+// RefundOrder returns all or part of an order's payment to the customer through
+// the payment gateway. Leaving amount out refunds everything not yet refunded. (admin only)
+func RefundOrder(c *gin.Context) {
+	orderID := c.Param("id")
+
+	var input struct {
+		Amount float64 `json:"amount"`
+		Reason string  `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order models.Order
+	if err := config.DB.First(&order, "id = ?", orderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var payment models.Payment
+	if err := config.DB.Where("order_id = ? AND status IN ?", order.ID,
+		[]models.PaymentStatus{models.PaymentStatusSuccess, models.PaymentStatusPartiallyRefunded, models.PaymentStatusRefunded}).
+		Order("created_at desc").First(&payment).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order has no settled payment to refund"})
+		return
+	}
+
+	refund, err := services.RefundPayment(c.Request.Context(), config.DB, paymentGateway, payment.ID, input.Amount, input.Reason, actorFromContext(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRefundAmount):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrPaymentNotRefundable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrRefundExceedsPayment):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrRefundPending):
+			log.Printf("Refund of order %s is pending: %v", order.ID, err)
+			c.JSON(http.StatusAccepted, gin.H{"error": "Refund is pending at the payment gateway", "refund": refund})
+		case errors.Is(err, services.ErrRefundFailed):
+			log.Printf("Refund of order %s failed: %v", order.ID, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Payment gateway refused the refund", "refund": refund})
+		default:
+			log.Printf("Refund of order %s failed: %v", order.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund payment"})
+		}
+		return
+	}
+
+	config.DB.Preload("Refunds").First(&payment, "id = ?", payment.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"refund":  refund,
+		"payment": payment,
+	})
+}
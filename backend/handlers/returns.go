@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"nexora-backend/config"
+	"nexora-backend/models"
+	"nexora-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// preloadReturns loads an order's return requests newest first
+func preloadReturns(db *gorm.DB) *gorm.DB {
+	return db.Order("created_at desc")
+}
+
+// respondReturnError maps return workflow errors to API responses
+func respondReturnError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidReturnItems):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOrderNotDelivered), errors.Is(err, services.ErrReturnWindowClosed):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidReturnTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrStaleReturn):
+		c.JSON(http.StatusConflict, gin.H{"error": "Return was updated by someone else, please retry"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update return"})
+	}
+}
+
+// loadReturn fetches a return request with its items, history and refund
+func loadReturn(db *gorm.DB, ret *models.ReturnRequest, query string, args ...interface{}) error {
+	return db.Preload("Items.OrderItem").Preload("History", preloadStatusHistory).Preload("Refund").
+		Where(query, args...).First(ret).Error
+}
+
+// CreateReturn opens a return request on items of one of the customer's delivered orders
+func CreateReturn(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	orderID := c.Param("id")
+
+	var input struct {
+		Items []struct {
+			OrderItemID string `json:"order_item_id" binding:"required"`
+			Quantity    int    `json:"quantity" binding:"required,min=1"`
+		} `json:"items" binding:"required,min=1,dive"`
+		Reason    string   `json:"reason" binding:"required"`
+		PhotoURLs []string `json:"photo_urls" binding:"omitempty,max=10,dive,url"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lines := make([]services.ReturnLine, 0, len(input.Items))
+	for _, item := range input.Items {
+		orderItemID, err := uuid.Parse(item.OrderItemID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order item ID"})
+			return
+		}
+		lines = append(lines, services.ReturnLine{OrderItemID: orderItemID, Quantity: item.Quantity})
+	}
+
+	var ret *models.ReturnRequest
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Serialize returns of the same order so quantities cannot be over-claimed,
+		// and read its items only once the lock is held
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ? AND user_id = ?", orderID, userID).First(&models.Order{}).Error; err != nil {
+			return err
+		}
+		var order models.Order
+		if err := tx.Preload("Items").First(&order, "id = ?", orderID).Error; err != nil {
+			return err
+		}
+		var err error
+		ret, err = services.OpenReturn(tx, &order, lines, input.Reason, input.PhotoURLs, actorFromContext(c), config.AppConfig.ReturnWindow)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		respondReturnError(c, err)
+		return
+	}
+
+	loadReturn(config.DB, ret, "id = ?", ret.ID)
+	c.JSON(http.StatusCreated, ret)
+}
+
+// CancelReturn withdraws a customer's return request before the goods are sent back
+func CancelReturn(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var ret models.ReturnRequest
+	if err := loadReturn(config.DB, &ret, "id = ? AND order_id = ? AND user_id = ?", c.Param("return_id"), c.Param("id"), userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		return
+	}
+
+	if err := services.TransitionReturn(config.DB, &ret, models.ReturnStatusCancelled, actorFromContext(c), "Cancelled by customer"); err != nil {
+		respondReturnError(c, err)
+		return
+	}
+
+	loadReturn(config.DB, &ret, "id = ?", ret.ID)
+	c.JSON(http.StatusOK, ret)
+}
+
+// GetReturns returns the return request queue, oldest open requests first (admin only)
+func GetReturns(c *gin.Context) {
+	p := pageParams(c, 20)
+
+	status := c.Query("status")
+
+	var returns []models.ReturnRequest
+	var total int64
+
+	query := config.DB.Model(&models.ReturnRequest{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Count(&total)
+
+	query = config.DB.Preload("Order").Preload("Items.OrderItem")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Order("created_at asc").
+		Offset(p.Offset()).Limit(p.Limit).
+		Find(&returns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch returns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pageResponse(p, "returns", returns, total))
+}
+
+// GetReturn returns a single return request with its order (admin only)
+func GetReturn(c *gin.Context) {
+	var ret models.ReturnRequest
+	if err := loadReturn(config.DB.Preload("Order.User"), &ret, "id = ?", c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ret)
+}
+
+// transitionReturn moves the return in the URL to a new status with an optional admin note
+func transitionReturn(c *gin.Context, to models.ReturnStatus) {
+	var input struct {
+		Note string `json:"note"`
+	}
+	c.ShouldBindJSON(&input)
+
+	var ret models.ReturnRequest
+	if err := loadReturn(config.DB, &ret, "id = ?", c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		return
+	}
+
+	if err := services.TransitionReturn(config.DB, &ret, to, actorFromContext(c), input.Note); err != nil {
+		respondReturnError(c, err)
+		return
+	}
+
+	loadReturn(config.DB, &ret, "id = ?", ret.ID)
+	c.JSON(http.StatusOK, ret)
+}
+
+// ApproveReturn accepts a return request so the customer can send the goods back (admin only)
+func ApproveReturn(c *gin.Context) {
+	transitionReturn(c, models.ReturnStatusApproved)
+}
+
+// RejectReturn declines a return request (admin only)
+func RejectReturn(c *gin.Context) {
+	transitionReturn(c, models.ReturnStatusRejected)
+}
+
+// ReceiveReturn records that the returned goods arrived at the warehouse (admin only)
+func ReceiveReturn(c *gin.Context) {
+	transitionReturn(c, models.ReturnStatusReceived)
+}
+
+// Why a return cannot be resolved right now
+var (
+	errReturnNotReceived      = errors.New("only received returns can be resolved")
+	errNoSettledPayment       = errors.New("order has no settled payment to refund")
+	errRefundAboveReturnValue = errors.New("refund exceeds what the returned items were paid for")
+)
+
+// ResolveReturn completes a received return, optionally putting the goods back
+// into stock and refunding them. The refund defaults to what the returned items
+// were paid for and cannot exceed it unless override_amount is set. (admin only)
+func ResolveReturn(c *gin.Context) {
+	var input struct {
+		Restock        bool    `json:"restock"`
+		Refund         bool    `json:"refund"`
+		RefundAmount   float64 `json:"refund_amount"`
+		OverrideAmount bool    `json:"override_amount"` // allow refunding more than the items' value
+		Note           string  `json:"note"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ret models.ReturnRequest
+	if err := loadReturn(config.DB, &ret, "id = ?", c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		return
+	}
+
+	actor := actorFromContext(c)
+
+	// Claim the refund under the return's row lock. The pending refund is
+	// linked before the gateway is called, so concurrent or repeated resolves
+	// never pay twice: a refund still pending is sent again with the same
+	// refund key, and only a refund the gateway rejected is replaced.
+	var refund *models.Refund
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			First(&models.ReturnRequest{}, "id = ?", ret.ID).Error; err != nil {
+			return err
+		}
+		if err := loadReturn(tx, &ret, "id = ?", ret.ID); err != nil {
+			return err
+		}
+		if ret.Status != models.ReturnStatusReceived {
+			return errReturnNotReceived
+		}
+		if !input.Refund {
+			return nil
+		}
+		if ret.Refund != nil {
+			switch ret.Refund.Status {
+			case models.RefundStatusSucceeded:
+				return nil
+			case models.RefundStatusPending:
+				refund = ret.Refund
+				return nil
+			}
+		}
+
+		var payment models.Payment
+		if err := tx.Where("order_id = ? AND status IN ?", ret.OrderID,
+			[]models.PaymentStatus{models.PaymentStatusSuccess, models.PaymentStatusPartiallyRefunded}).
+			Order("created_at desc").First(&payment).Error; err != nil {
+			return errNoSettledPayment
+		}
+
+		value := services.ReturnValue(&ret)
+		amount := input.RefundAmount
+		if amount == 0 {
+			amount = value
+		}
+		if amount <= 0 {
+			return services.ErrInvalidRefundAmount
+		}
+		if amount > value && !input.OverrideAmount {
+			return errRefundAboveReturnValue
+		}
+
+		var err error
+		if refund, err = services.CreateRefund(tx, payment.ID, amount, "Return: "+ret.Reason, actor); err != nil {
+			return err
+		}
+		ret.RefundID = &refund.ID
+		return tx.Model(&models.ReturnRequest{}).Where("id = ?", ret.ID).Update("refund_id", refund.ID).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errReturnNotReceived), errors.Is(err, errNoSettledPayment),
+			errors.Is(err, services.ErrPaymentNotRefundable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidRefundAmount), errors.Is(err, errRefundAboveReturnValue):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrRefundExceedsPayment):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Refund of return %s failed: %v", ret.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund payment"})
+		}
+		return
+	}
+
+	if refund != nil {
+		if err := services.SendRefund(c.Request.Context(), config.DB, paymentGateway, refund); err != nil {
+			log.Printf("Refund of return %s failed: %v", ret.ID, err)
+			if errors.Is(err, services.ErrRefundFailed) {
+				c.JSON(http.StatusBadGateway, gin.H{"error": "Payment gateway refused the refund", "refund": refund})
+				return
+			}
+			if errors.Is(err, services.ErrRefundPending) {
+				c.JSON(http.StatusAccepted, gin.H{"error": "Refund is pending at the payment gateway; resolve the return again to retry", "refund": refund})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund payment"})
+			return
+		}
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if input.Restock && !ret.Restocked {
+			if err := services.RestockReturn(tx, &ret, actor); err != nil {
+				return err
+			}
+		}
+		return services.TransitionReturn(tx, &ret, models.ReturnStatusCompleted, actor, input.Note)
+	})
+	if err != nil {
+		respondReturnError(c, err)
+		return
+	}
+
+	loadReturn(config.DB, &ret, "id = ?", ret.ID)
+	c.JSON(http.StatusOK, ret)
+}
@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"nexora-backend/config"
+	"nexora-backend/models"
+	"nexora-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// QuoteShipping returns the shipping fee for a destination and a set of items.
+// Items default to the cart of the signed in user or guest; address_id may be used
+// instead of an explicit destination by signed in users.
+func QuoteShipping(c *gin.Context) {
+	var input struct {
+		AddressID  string              `json:"address_id"`
+		State      string              `json:"state"`
+		City       string              `json:"city"`
+		PostalCode string              `json:"postal_code"`
+		Courier    string              `json:"courier"`
+		Items      []checkoutItemInput `json:"items" binding:"dive"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, signedIn := c.Get("user_id")
+
+	dest := services.ShippingDestination{State: input.State, City: input.City, PostalCode: input.PostalCode}
+	if input.AddressID != "" {
+		if !signedIn {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in to quote a saved address"})
+			return
+		}
+		var address models.Address
+		if err := config.DB.Where("id = ? AND user_id = ?", input.AddressID, userID).First(&address).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+			return
+		}
+		dest = services.ShippingDestination{State: address.State, City: address.City, PostalCode: address.PostalCode}
+	}
+
+	var subtotal float64
+	var weight int
+
+	if len(input.Items) > 0 {
+		lines, ok := checkoutLinesFromItems(c, input.Items)
+		if !ok {
+			return
+		}
+		for _, line := range lines {
+			subtotal += line.Item.Subtotal
+			weight += line.Weight * line.Item.Quantity
+		}
+	} else if scope, ok := cartScope(c); ok {
+		var cartItems []models.CartItem
+		if err := config.DB.Scopes(services.PreloadCartItems, scope).Find(&cartItems).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+			return
+		}
+		// Weigh only what checkout would accept, as the cart subtotal does
+		var available []models.CartItem
+		for _, item := range cartItems {
+			if services.CartItemAvailable(item) && services.AvailableStock(item.Product, item.Variant) > 0 {
+				available = append(available, item)
+			}
+		}
+		for _, line := range services.CartLines(available) {
+			subtotal += line.Item.Subtotal
+			weight += line.Weight * line.Item.Quantity
+		}
+	}
+
+	if weight == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No items to quote"})
+		return
+	}
+
+	quotes, err := services.QuoteShipping(config.DB, dest, weight, input.Courier, subtotal)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownCourier) || errors.Is(err, services.ErrNoShippingZone) ||
+			errors.Is(err, services.ErrNoShippingRate) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to quote shipping"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"weight":   weight,
+		"subtotal": subtotal,
+		"quotes":   quotes,
+	})
+}
+
+// shippingZoneInput is the request body for creating and updating shipping zones.
+// Regions and rates replace the existing ones when present.
+type shippingZoneInput struct {
+	Name            string                       `json:"name"`
+	IsDefault       *bool                        `json:"is_default"`
+	FreeShippingMin *float64                     `json:"free_shipping_min"`
+	IsActive        *bool                        `json:"is_active"`
+	Regions         *[]models.ShippingZoneRegion `json:"regions"`
+	Rates           *[]models.ShippingRate       `json:"rates"`
+}
+
+// apply copies the provided fields onto the zone and validates the result
+func (input *shippingZoneInput) apply(zone *models.ShippingZone) error {
+	if input.Name != "" {
+		zone.Name = input.Name
+	}
+	if input.IsDefault != nil {
+		zone.IsDefault = *input.IsDefault
+	}
+	if input.FreeShippingMin != nil {
+		zone.FreeShippingMin = *input.FreeShippingMin
+	}
+	if input.IsActive != nil {
+		zone.IsActive = *input.IsActive
+	}
+
+	if zone.Name == "" {
+		return errors.New("name is required")
+	}
+	if zone.FreeShippingMin < 0 {
+		return errors.New("free_shipping_min cannot be negative")
+	}
+	if input.Rates != nil {
+		for _, rate := range *input.Rates {
+			if rate.MinWeight < 0 || rate.Fee < 0 || rate.PerKgFee < 0 {
+				return errors.New("rates cannot be negative")
+			}
+			if rate.MaxWeight != 0 && rate.MaxWeight <= rate.MinWeight {
+				return errors.New("max_weight must be greater than min_weight")
+			}
+		}
+	}
+	return nil
+}
+
+// save writes the zone and replaces its regions and rates inside tx
+func (input *shippingZoneInput) save(tx *gorm.DB, zone *models.ShippingZone) error {
+	if err := tx.Omit("Regions", "Rates").Save(zone).Error; err != nil {
+		return err
+	}
+
+	// Only one zone can be the fallback
+	if zone.IsDefault {
+		if err := tx.Model(&models.ShippingZone{}).Where("id != ?", zone.ID).
+			Update("is_default", false).Error; err != nil {
+			return err
+		}
+	}
+
+	if input.Regions != nil {
+		if err := tx.Where("zone_id = ?", zone.ID).Delete(&models.ShippingZoneRegion{}).Error; err != nil {
+			return err
+		}
+		for _, region := range *input.Regions {
+			region.ID = uuid.Nil
+			region.ZoneID = zone.ID
+			region.State = strings.TrimSpace(region.State)
+			region.City = strings.TrimSpace(region.City)
+			region.PostalPrefix = strings.TrimSpace(region.PostalPrefix)
+			if err := tx.Create(&region).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if input.Rates != nil {
+		if err := tx.Where("zone_id = ?", zone.ID).Delete(&models.ShippingRate{}).Error; err != nil {
+			return err
+		}
+		for _, rate := range *input.Rates {
+			rate.ID = uuid.Nil
+			rate.ZoneID = zone.ID
+			if err := tx.Create(&rate).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// preloadShippingRates loads weight bands lightest first
+func preloadShippingRates(db *gorm.DB) *gorm.DB {
+	return db.Order("min_weight asc")
+}
+
+// GetShippingZones returns all shipping zones with their regions and rates (admin only)
+func GetShippingZones(c *gin.Context) {
+	var zones []models.ShippingZone
+	if err := config.DB.Preload("Regions").Preload("Rates", preloadShippingRates).
+		Order("name asc").Find(&zones).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping zones"})
+		return
+	}
+
+	c.JSON(http.StatusOK, zones)
+}
+
+// CreateShippingZone creates a shipping zone (admin only)
+func CreateShippingZone(c *gin.Context) {
+	var input shippingZoneInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	zone := models.ShippingZone{IsActive: true}
+	if err := input.apply(&zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return input.save(tx, &zone)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create shipping zone"})
+		return
+	}
+
+	config.DB.Preload("Regions").Preload("Rates", preloadShippingRates).First(&zone, "id = ?", zone.ID)
+	c.JSON(http.StatusCreated, zone)
+}
+
+// UpdateShippingZone updates a shipping zone (admin only)
+func UpdateShippingZone(c *gin.Context) {
+	id := c.Param("id")
+
+	var zone models.ShippingZone
+	if err := config.DB.First(&zone, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipping zone not found"})
+		return
+	}
+
+	var input shippingZoneInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := input.apply(&zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return input.save(tx, &zone)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shipping zone"})
+		return
+	}
+
+	config.DB.Preload("Regions").Preload("Rates", preloadShippingRates).First(&zone, "id = ?", zone.ID)
+	c.JSON(http.StatusOK, zone)
+}
+
+// DeleteShippingZone soft deletes a shipping zone (admin only)
+func DeleteShippingZone(c *gin.Context) {
+	id := c.Param("id")
+
+	var zone models.ShippingZone
+	if err := config.DB.First(&zone, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipping zone not found"})
+		return
+	}
+
+	if err := config.DB.Delete(&zone).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shipping zone"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping zone deleted successfully"})
+}
+
+// GetShippingCouriers returns all couriers with their rate multipliers (admin only)
+func GetShippingCouriers(c *gin.Context) {
+	var couriers []models.ShippingCourier
+	if err := config.DB.Order("code asc").Find(&couriers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch couriers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, couriers)
+}
+
+// CreateShippingCourier adds a courier customers can choose (admin only)
+func CreateShippingCourier(c *gin.Context) {
+	var input struct {
+		Code       string  `json:"code" binding:"required"`
+		Name       string  `json:"name" binding:"required"`
+		Multiplier float64 `json:"multiplier"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Multiplier < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Multiplier must be greater than 0"})
+		return
+	}
+	if input.Multiplier == 0 {
+		input.Multiplier = 1
+	}
+
+	courier := models.ShippingCourier{
+		Code:       strings.ToLower(strings.TrimSpace(input.Code)),
+		Name:       input.Name,
+		Multiplier: input.Multiplier,
+		IsActive:   true,
+	}
+
+	var existing int64
+	config.DB.Unscoped().Model(&models.ShippingCourier{}).Where("code = ?", courier.Code).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Courier code already exists"})
+		return
+	}
+
+	if err := config.DB.Create(&courier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create courier"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, courier)
+}
+
+// UpdateShippingCourier updates a courier's name, multiplier or availability (admin only)
+func UpdateShippingCourier(c *gin.Context) {
+	id := c.Param("id")
+
+	var courier models.ShippingCourier
+	if err := config.DB.First(&courier, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Courier not found"})
+		return
+	}
+
+	var input struct {
+		Name       string   `json:"name"`
+		Multiplier *float64 `json:"multiplier"`
+		IsActive   *bool    `json:"is_active"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name != "" {
+		courier.Name = input.Name
+	}
+	if input.Multiplier != nil {
+		if *input.Multiplier <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Multiplier must be greater than 0"})
+			return
+		}
+		courier.Multiplier = *input.Multiplier
+	}
+	if input.IsActive != nil {
+		courier.IsActive = *input.IsActive
+	}
+
+	if err := config.DB.Save(&courier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update courier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, courier)
+}
+
+// DeleteShippingCourier soft deletes a courier (admin only)
+func DeleteShippingCourier(c *gin.Context) {
+	id := c.Param("id")
+
+	var courier models.ShippingCourier
+	if err := config.DB.First(&courier, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Courier not found"})
+		return
+	}
+
+	if err := config.DB.Delete(&courier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete courier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Courier deleted successfully"})
+}
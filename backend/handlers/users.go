@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
-	"strconv"
+	"time"
 
 	"nexora-backend/config"
 	"nexora-backend/models"
+	"nexora-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -258,27 +260,35 @@ func CreateReview(c *gin.Context) {
 
 // GetAllUsers returns all users (admin only)
 func GetAllUsers(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
-	offset := (page - 1) * limit
+	p, err := paginate(c, 20)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
 
 	var users []models.User
-	var total int64
 
+	if p.Cursor != nil {
+		if err := p.Apply(config.DB, "users", true).Find(&users).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+			return
+		}
+		page, next, prev := cursorPage(p, users, func(user models.User) (time.Time, uuid.UUID) {
+			return user.CreatedAt, user.ID
+		})
+		c.JSON(http.StatusOK, cursorResponse(p, "users", page, next, prev))
+		return
+	}
+
+	var total int64
 	config.DB.Model(&models.User{}).Count(&total)
 
-	if err := config.DB.Order("created_at desc").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+	if err := p.Apply(config.DB, "users", true).Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"users": users,
-		"total": total,
-		"page":  page,
-		"limit": limit,
-		"pages": (total + int64(limit) - 1) / int64(limit),
-	})
+	c.JSON(http.StatusOK, pageResponse(p, "users", users, total))
 }
 
 // UpdateUserRole updates a user's role (admin only)
@@ -333,6 +343,12 @@ func GetDashboardStats(c *gin.Context) {
 	var recentOrders []models.Order
 	config.DB.Preload("User").Order("created_at desc").Limit(5).Find(&recentOrders)
 
+	// Abandoned cart recovery
+	cartRecovery, err := services.GetCartRecoveryStats(config.DB)
+	if err != nil {
+		log.Printf("Failed to compute cart recovery stats: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"total_users":    totalUsers,
 		"total_products": totalProducts,
@@ -340,5 +356,6 @@ func GetDashboardStats(c *gin.Context) {
 		"total_revenue":  totalRevenue,
 		"pending_orders": pendingOrders,
 		"recent_orders":  recentOrders,
+		"cart_recovery":  cartRecovery,
 	})
 }
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+
+	"nexora-backend/config"
+	"nexora-backend/models"
+	"nexora-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var webhookSender *services.WebhookSender
+
+// InitWebhooks sets the sender used to redeliver webhooks by hand
+func InitWebhooks(sender *services.WebhookSender) {
+	webhookSender = sender
+}
+
+// validateWebhook checks a subscription URL and its event types, returning
+// the problem to report
+func validateWebhook(rawURL string, events []string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "URL must be an absolute http(s) URL"
+	}
+	if len(events) == 0 {
+		return "At least one event type is required"
+	}
+	for _, event := range events {
+		if !services.IsWebhookEventType(event) {
+			return "Unknown event type " + event
+		}
+	}
+	return ""
+}
+
+// GetWebhooks lists webhook subscriptions and the event types they can use (admin only)
+func GetWebhooks(c *gin.Context) {
+	var subscriptions []models.WebhookSubscription
+	if err := config.DB.Order("created_at").Find(&subscriptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks":    subscriptions,
+		"event_types": services.WebhookEventTypes,
+	})
+}
+
+// CreateWebhook adds a webhook subscription. The signing secret is generated
+// unless given and is only returned here. (admin only)
+func CreateWebhook(c *gin.Context) {
+	var input struct {
+		URL         string   `json:"url" binding:"required"`
+		Events      []string `json:"events" binding:"required"`
+		Secret      string   `json:"secret"`
+		Description string   `json:"description"`
+		IsActive    *bool    `json:"is_active"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if problem := validateWebhook(input.URL, input.Events); problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return
+	}
+
+	secret := input.Secret
+	if secret == "" {
+		var err error
+		if secret, err = services.NewWebhookSecret(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+	}
+
+	subscription := models.WebhookSubscription{
+		URL:         input.URL,
+		Secret:      secret,
+		Events:      input.Events,
+		Description: input.Description,
+		IsActive:    input.IsActive == nil || *input.IsActive,
+	}
+	// Create skips false bools in favour of the column default
+	if err := config.DB.Select("*").Create(&subscription).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": subscription,
+		"secret":  secret,
+	})
+}
+
+// UpdateWebhook changes a webhook subscription; a new secret can be set to
+// rotate it (admin only)
+func UpdateWebhook(c *gin.Context) {
+	var subscription models.WebhookSubscription
+	if err := config.DB.First(&subscription, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	var input struct {
+		URL         *string  `json:"url"`
+		Events      []string `json:"events"`
+		Secret      *string  `json:"secret"`
+		Description *string  `json:"description"`
+		IsActive    *bool    `json:"is_active"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.URL != nil {
+		subscription.URL = *input.URL
+	}
+	if input.Events != nil {
+		subscription.Events = input.Events
+	}
+	if problem := validateWebhook(subscription.URL, subscription.Events); problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return
+	}
+	if input.Secret != nil {
+		if *input.Secret == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Secret cannot be empty"})
+			return
+		}
+		subscription.Secret = *input.Secret
+	}
+	if input.Description != nil {
+		subscription.Description = *input.Description
+	}
+	if input.IsActive != nil {
+		subscription.IsActive = *input.IsActive
+	}
+
+	if err := config.DB.Save(&subscription).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// DeleteWebhook removes a webhook subscription; its pending deliveries fail
+// on their next attempt (admin only)
+func DeleteWebhook(c *gin.Context) {
+	result := config.DB.Delete(&models.WebhookSubscription{}, "id = ?", c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// GetWebhookDeliveries lists the deliveries of a subscription, newest first,
+// filterable by status and event type (admin only)
+func GetWebhookDeliveries(c *gin.Context) {
+	p := pageParams(c, 50)
+
+	query := config.DB.Model(&models.WebhookDelivery{}).Where("subscription_id = ?", c.Param("id"))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("created_at desc").Offset(p.Offset()).Limit(p.Limit).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pageResponse(p, "deliveries", deliveries, total))
+}
+
+// preloadDeliveryLog orders the attempts of a delivery oldest first
+func preloadDeliveryLog(db *gorm.DB) *gorm.DB {
+	return db.Order("created_at")
+}
+
+// GetWebhookDelivery gets a delivery with the log of its attempts (admin only)
+func GetWebhookDelivery(c *gin.Context) {
+	var delivery models.WebhookDelivery
+	if err := config.DB.Preload("Subscription").Preload("Log", preloadDeliveryLog).
+		First(&delivery, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// RedeliverWebhook sends a delivery again right away, whatever its status.
+// A failed attempt is retried with backoff like a new delivery. (admin only)
+func RedeliverWebhook(c *gin.Context) {
+	var delivery models.WebhookDelivery
+	if err := config.DB.First(&delivery, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+
+	if err := webhookSender.Redeliver(c.Request.Context(), config.DB, &delivery); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeliver webhook"})
+		return
+	}
+
+	config.DB.Preload("Subscription").Preload("Log", preloadDeliveryLog).First(&delivery, "id = ?", delivery.ID)
+	c.JSON(http.StatusOK, delivery)
+}
@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"nexora-backend/services"
+
+	"gorm.io/gorm"
+)
+
+// abandonedCartBatchSize caps how many recovery emails are queued per run
+const abandonedCartBatchSize = 100
+
+// StartAbandonedCartRecovery starts the job that emails customers about carts
+// left untouched for opts.IdleFor
+func StartAbandonedCartRecovery(ctx context.Context, db *gorm.DB, opts services.CartRecoveryOptions, interval time.Duration) {
+	log.Printf("Abandoned cart job running every %s for carts idle longer than %s", interval, opts.IdleFor)
+
+	opts.Limit = abandonedCartBatchSize
+	go Every(ctx, "abandoned-cart-recovery", interval, func(ctx context.Context) error {
+		sent, err := services.SendAbandonedCartEmails(ctx, db.WithContext(ctx), opts)
+		if sent > 0 {
+			log.Printf("Abandoned carts: queued %d recovery emails", sent)
+		}
+		return err
+	})
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"nexora-backend/services"
+
+	"gorm.io/gorm"
+)
+
+// emailOutboxBatchSize caps how many queued emails are sent per run
+const emailOutboxBatchSize = 50
+
+// StartEmailOutbox starts the job that sends queued emails and retries failed ones
+func StartEmailOutbox(ctx context.Context, db *gorm.DB, mailer services.Mailer, interval time.Duration) {
+	log.Printf("Email outbox job running every %s", interval)
+
+	go Every(ctx, "email-outbox", interval, func(ctx context.Context) error {
+		sent, err := services.SendPendingEmails(ctx, db.WithContext(ctx), mailer, emailOutboxBatchSize)
+		if sent > 0 {
+			log.Printf("Email outbox: sent %d emails", sent)
+		}
+		return err
+	})
+}
@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"nexora-backend/services"
+
+	"gorm.io/gorm"
+)
+
+// eventDispatchBatchSize caps how many domain events are delivered per run
+const eventDispatchBatchSize = 100
+
+// StartEventDispatcher starts the job that delivers domain events from the
+// outbox to the subscribers registered on bus
+func StartEventDispatcher(ctx context.Context, db *gorm.DB, bus *services.EventBus, interval time.Duration) {
+	log.Printf("Event dispatcher running every %s", interval)
+
+	go Every(ctx, "event-dispatcher", interval, func(ctx context.Context) error {
+		_, err := services.DispatchEvents(ctx, db.WithContext(ctx), bus, eventDispatchBatchSize)
+		return err
+	})
+}
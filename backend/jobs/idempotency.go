@@ -0,0 +1,17 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"nexora-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// StartIdempotencyKeyCleanup periodically deletes idempotency keys past their window
+func StartIdempotencyKeyCleanup(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	go Every(ctx, "idempotency-key-cleanup", interval, func(ctx context.Context) error {
+		return db.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&models.IdempotencyKey{}).Error
+	})
+}
@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"nexora-backend/services"
+
+	"gorm.io/gorm"
+)
+
+// StartOrderExpiry starts the background reaper that cancels unpaid orders older than ttl
+func StartOrderExpiry(ctx context.Context, db *gorm.DB, ttl, interval time.Duration) {
+	log.Printf("Order expiry job running every %s for pending orders older than %s", interval, ttl)
+
+	go Every(ctx, "order-expiry", interval, func(ctx context.Context) error {
+		expired, err := services.ExpirePendingOrders(db.WithContext(ctx), ttl)
+		if expired > 0 {
+			log.Printf("Order expiry: cancelled %d unpaid orders", expired)
+		}
+		return err
+	})
+}
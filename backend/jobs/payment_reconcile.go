@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"nexora-backend/services"
+
+	"gorm.io/gorm"
+)
+
+// StartPaymentReconciliation starts the job that checks payments still pending
+// after minAge with the gateway, in case their webhook was lost
+func StartPaymentReconciliation(ctx context.Context, db *gorm.DB, gateway services.PaymentGateway, minAge, interval time.Duration) {
+	log.Printf("Payment reconciliation job running every %s for payments pending longer than %s", interval, minAge)
+
+	go Every(ctx, "payment-reconciliation", interval, func(ctx context.Context) error {
+		report, err := services.ReconcilePayments(ctx, db.WithContext(ctx), gateway, time.Time{}, time.Now().Add(-minAge))
+		if report != nil {
+			for _, m := range report.Mismatches {
+				log.Printf("Payment reconciliation: %s was %s locally but %s at the gateway -> %s (%s) %s",
+					m.Reference, m.LocalStatus, m.GatewayStatus, m.NewStatus, m.Outcome, m.Detail)
+			}
+		}
+		return err
+	})
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"nexora-backend/services"
+
+	"gorm.io/gorm"
+)
+
+// shipmentBatchSize caps how many shipped orders are polled per run
+const shipmentBatchSize = 50
+
+// StartShipmentTracking starts the poller that feeds courier tracking into shipped orders
+func StartShipmentTracking(ctx context.Context, db *gorm.DB, registry *services.CourierRegistry, interval time.Duration) {
+	log.Printf("Shipment tracking job running every %s", interval)
+
+	go Every(ctx, "shipment-tracking", interval, func(ctx context.Context) error {
+		delivered, err := services.SyncShippedOrders(ctx, db.WithContext(ctx), registry, shipmentBatchSize)
+		if delivered > 0 {
+			log.Printf("Shipment tracking: marked %d orders delivered", delivered)
+		}
+		return err
+	})
+}
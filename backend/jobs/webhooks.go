@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"nexora-backend/services"
+
+	"gorm.io/gorm"
+)
+
+// webhookBatchSize caps how many webhook deliveries are attempted per run
+const webhookBatchSize = 50
+
+// StartWebhookDelivery starts the job that posts queued webhook deliveries and
+// retries failed ones
+func StartWebhookDelivery(ctx context.Context, db *gorm.DB, sender *services.WebhookSender, interval time.Duration) {
+	log.Printf("Webhook delivery job running every %s", interval)
+
+	go Every(ctx, "webhook-delivery", interval, func(ctx context.Context) error {
+		_, err := sender.SendPending(ctx, db.WithContext(ctx), webhookBatchSize)
+		return err
+	})
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"nexora-backend/config"
 	"nexora-backend/handlers"
+	"nexora-backend/jobs"
 	"nexora-backend/middleware"
 	"nexora-backend/models"
+	"nexora-backend/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,10 +32,31 @@ func main() {
 		&models.ProductVariant{},
 		&models.Review{},
 		&models.CartItem{},
+		&models.CartRecovery{},
+		&models.OutboundEmail{},
+		&models.DomainEvent{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.WebhookDeliveryAttempt{},
 		&models.WishlistItem{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderStatusHistory{},
 		&models.Payment{},
+		&models.Refund{},
+		&models.PaymentNotification{},
+		&models.ReturnRequest{},
+		&models.ReturnItem{},
+		&models.ReturnStatusHistory{},
+		&models.IdempotencyKey{},
+		&models.StockMovement{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.ShippingZone{},
+		&models.ShippingZoneRegion{},
+		&models.ShippingRate{},
+		&models.ShippingCourier{},
+		&models.ShipmentEvent{},
 	)
 
 	// Fix NOT NULL constraint on user_id and address_id for guest orders
@@ -39,9 +64,72 @@ func main() {
 	db.Exec("ALTER TABLE orders ALTER COLUMN user_id DROP NOT NULL")
 	db.Exec("ALTER TABLE orders ALTER COLUMN address_id DROP NOT NULL")
 
+	// Guest carts have a cart token instead of a user
+	db.Exec("ALTER TABLE cart_items ALTER COLUMN user_id DROP NOT NULL")
+
+	// Give stock that predates the inventory ledger an opening balance
+	if err := services.RecordOpeningBalances(db); err != nil {
+		log.Println("Failed to record opening stock balances:", err)
+	}
+
+	// Full-text product search: search_vector column, triggers and indexes
+	if err := services.EnsureProductSearch(db); err != nil {
+		log.Println("Failed to set up product search:", err)
+	}
+
+	// Start with the old flat shipping rate until admins set up rate tables
+	if err := services.EnsureShippingRates(db); err != nil {
+		log.Println("Failed to create default shipping rates:", err)
+	}
+
 	// Initialize OAuth
 	handlers.InitOAuth()
 
+	// Initialize payment gateway
+	gateway, err := services.NewPaymentGateway(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize payment gateway:", err)
+	}
+	handlers.InitPaymentGateway(gateway)
+
+	// Initialize courier tracking
+	couriers := services.NewCourierRegistryFromConfig(cfg)
+	handlers.InitCourierTracking(couriers)
+
+	// Initialize outgoing mail
+	mailer, err := services.NewMailerFromConfig(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize mailer:", err)
+	}
+	services.InitOrderEmails(services.OrderEmailOptions{
+		FrontendURL: cfg.FrontendURL,
+		AdminEmail:  cfg.AdminEmail,
+	})
+
+	// Domain events: changes publish to the outbox, subscribers react afterwards
+	services.InitLowStockAlerts(cfg.LowStockThreshold)
+	bus := services.NewEventBus()
+	services.RegisterEventSubscribers(bus)
+
+	// Outbound webhooks for integrators
+	webhookSender := services.NewWebhookSender()
+	handlers.InitWebhooks(webhookSender)
+
+	// Background jobs
+	jobs.StartOrderExpiry(context.Background(), db, cfg.PendingOrderTTL, cfg.OrderExpiryInterval)
+	jobs.StartIdempotencyKeyCleanup(context.Background(), db, time.Hour)
+	jobs.StartShipmentTracking(context.Background(), db, couriers, cfg.ShipmentPollInterval)
+	jobs.StartPaymentReconciliation(context.Background(), db, gateway, cfg.PaymentReconcileAfter, cfg.PaymentReconcileInterval)
+	jobs.StartAbandonedCartRecovery(context.Background(), db, services.CartRecoveryOptions{
+		Secret:      cfg.JWTSecret,
+		FrontendURL: cfg.FrontendURL,
+		APIURL:      cfg.APIURL,
+		IdleFor:     cfg.AbandonedCartAfter,
+	}, cfg.AbandonedCartInterval)
+	jobs.StartEmailOutbox(context.Background(), db, mailer, cfg.EmailOutboxInterval)
+	jobs.StartEventDispatcher(context.Background(), db, bus, cfg.EventDispatchInterval)
+	jobs.StartWebhookDelivery(context.Background(), db, webhookSender, cfg.WebhookDeliveryInterval)
+
 	// Setup Gin router
 	if cfg.Env == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -84,15 +172,19 @@ func main() {
 			categories.GET("", handlers.GetCategories)
 		}
 
-		// Cart routes (authenticated)
+		// Cart routes (signed in users, or guests by cart token)
 		cart := api.Group("/cart")
-		cart.Use(middleware.AuthMiddleware())
+		cart.Use(middleware.OptionalAuthMiddleware())
 		{
 			cart.GET("", handlers.GetCart)
 			cart.POST("", handlers.AddToCart)
 			cart.PUT("/:id", handlers.UpdateCartItem)
 			cart.DELETE("/:id", handlers.RemoveFromCart)
 			cart.DELETE("", handlers.ClearCart)
+			cart.POST("/accept-prices", handlers.AcceptCartPrices)
+			cart.POST("/merge", middleware.AuthMiddleware(), handlers.MergeCart)
+			cart.POST("/recover", handlers.RecoverCart)
+			cart.GET("/recover/:id/open", handlers.TrackCartRecoveryOpen)
 		}
 
 		// Wishlist routes (authenticated)
@@ -109,16 +201,20 @@ func main() {
 		orders.Use(middleware.AuthMiddleware())
 		{
 			orders.GET("", handlers.GetOrders)
-			orders.POST("", handlers.CreateOrder)
+			orders.POST("", middleware.IdempotencyMiddleware(), handlers.CreateOrder)
 			orders.GET("/:id", handlers.GetOrder)
 			orders.POST("/:id/cancel", handlers.CancelOrder)
+			orders.POST("/:id/returns", handlers.CreateReturn)
+			orders.POST("/:id/returns/:return_id/cancel", handlers.CancelReturn)
 		}
 
 		// Guest checkout routes (public)
-		api.POST("/guest/order", handlers.CreateGuestOrder)
+		api.POST("/guest/order", middleware.IdempotencyMiddleware(), handlers.CreateGuestOrder)
 		api.POST("/guest/track", handlers.TrackOrder)
-		api.POST("/guest/payment/:order_id", handlers.CreateGuestPayment)
-		api.POST("/guest/payment/:order_id/simulate", handlers.SimulateGuestPayment)
+		api.POST("/guest/payment/:order_id", middleware.IdempotencyMiddleware(), handlers.CreateGuestPayment)
+
+		// Shipping routes (public, cart aware when signed in)
+		api.POST("/shipping/quote", middleware.OptionalAuthMiddleware(), handlers.QuoteShipping)
 
 		// Tracking routes (public)
 		api.POST("/tracking", handlers.TrackShipment)
@@ -128,9 +224,13 @@ func main() {
 		payments := api.Group("/payments")
 		{
 			payments.POST("/notification", handlers.PaymentNotification)
-			payments.POST("/:order_id", middleware.AuthMiddleware(), handlers.CreatePayment)
+			payments.POST("/:order_id", middleware.AuthMiddleware(), middleware.IdempotencyMiddleware(), handlers.CreatePayment)
 			payments.GET("/:order_id/status", middleware.AuthMiddleware(), handlers.GetPaymentStatus)
-			payments.POST("/:order_id/simulate", middleware.AuthMiddleware(), handlers.SimulatePayment)
+
+			// In-process stand-in for the hosted payment page
+			if cfg.PaymentProvider == services.ProviderFake {
+				payments.GET("/fake/:reference/pay", handlers.FakePaymentPage)
+			}
 		}
 
 		// User routes (authenticated)
@@ -157,15 +257,65 @@ func main() {
 			admin.PUT("/products/:id", handlers.UpdateProduct)
 			admin.DELETE("/products/:id", handlers.DeleteProduct)
 
+			// Inventory ledger
+			admin.GET("/products/:id/stock-movements", handlers.GetStockMovements)
+			admin.POST("/products/:id/stock-movements", handlers.AdjustStock)
+			admin.POST("/products/:id/stock/rebuild", handlers.RebuildProductStock)
+
 			// Category management
 			admin.POST("/categories", handlers.CreateCategory)
 			admin.PUT("/categories/:id", handlers.UpdateCategory)
 			admin.DELETE("/categories/:id", handlers.DeleteCategory)
 
+			// Coupon management
+			admin.GET("/coupons", handlers.GetCoupons)
+			admin.POST("/coupons", handlers.CreateCoupon)
+			admin.PUT("/coupons/:id", handlers.UpdateCoupon)
+			admin.DELETE("/coupons/:id", handlers.DeleteCoupon)
+
+			// Shipping rate tables
+			admin.GET("/shipping/zones", handlers.GetShippingZones)
+			admin.POST("/shipping/zones", handlers.CreateShippingZone)
+			admin.PUT("/shipping/zones/:id", handlers.UpdateShippingZone)
+			admin.DELETE("/shipping/zones/:id", handlers.DeleteShippingZone)
+			admin.GET("/shipping/couriers", handlers.GetShippingCouriers)
+			admin.POST("/shipping/couriers", handlers.CreateShippingCourier)
+			admin.PUT("/shipping/couriers/:id", handlers.UpdateShippingCourier)
+			admin.DELETE("/shipping/couriers/:id", handlers.DeleteShippingCourier)
+
 			// Order management
 			admin.GET("/orders", handlers.GetAllOrders)
 			admin.GET("/orders/:id", handlers.AdminGetOrderDetail)
 			admin.PUT("/orders/:id/status", handlers.UpdateOrderStatus)
+			admin.GET("/orders/:id/refunds", handlers.GetOrderRefunds)
+			admin.POST("/orders/:id/refunds", handlers.RefundOrder)
+			admin.GET("/payments/notifications", handlers.GetPaymentNotifications)
+			admin.POST("/payments/notifications/:id/replay", handlers.ReplayPaymentNotification)
+
+			// Outgoing email
+			admin.GET("/emails", handlers.GetEmails)
+			admin.POST("/emails/:id/retry", handlers.RetryEmail)
+
+			// Domain events
+			admin.GET("/events", handlers.GetEvents)
+			admin.POST("/events/:id/retry", handlers.RetryEvent)
+
+			// Webhooks
+			admin.GET("/webhooks", handlers.GetWebhooks)
+			admin.POST("/webhooks", handlers.CreateWebhook)
+			admin.PUT("/webhooks/:id", handlers.UpdateWebhook)
+			admin.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+			admin.GET("/webhooks/:id/deliveries", handlers.GetWebhookDeliveries)
+			admin.GET("/webhooks/deliveries/:id", handlers.GetWebhookDelivery)
+			admin.POST("/webhooks/deliveries/:id/redeliver", handlers.RedeliverWebhook)
+
+			// Returns
+			admin.GET("/returns", handlers.GetReturns)
+			admin.GET("/returns/:id", handlers.GetReturn)
+			admin.POST("/returns/:id/approve", handlers.ApproveReturn)
+			admin.POST("/returns/:id/reject", handlers.RejectReturn)
+			admin.POST("/returns/:id/receive", handlers.ReceiveReturn)
+			admin.POST("/returns/:id/resolve", handlers.ResolveReturn)
 
 			// User management
 			admin.GET("/users", handlers.GetAllUsers)
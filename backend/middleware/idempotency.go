@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"nexora-backend/config"
+	"nexora-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// idempotencyRecorder keeps a copy of the response body while it is written
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes a route safe to retry. When the request carries an
+// Idempotency-Key header, the first response for that key is stored and replayed
+// for retries with the same body. Reusing a key with a different body is rejected
+// with 422. Keys are scoped to the authenticated user (or the guest client) and
+// the route, so it must run after AuthMiddleware on authenticated routes.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := guestScope(c)
+		if userID, exists := c.Get("user_id"); exists {
+			scope = userID.(string)
+		}
+		scope += " " + c.Request.Method + " " + c.FullPath()
+
+		hash := sha256.Sum256(append([]byte(c.Request.URL.Path+"\n"), body...))
+		requestHash := hex.EncodeToString(hash[:])
+
+		// Forget keys whose window has passed
+		config.DB.Where("key = ? AND scope = ? AND expires_at <= ?", key, scope, time.Now()).
+			Delete(&models.IdempotencyKey{})
+
+		record := models.IdempotencyKey{
+			Key:         key,
+			Scope:       scope,
+			RequestHash: requestHash,
+			ExpiresAt:   time.Now().Add(config.AppConfig.IdempotencyTTL),
+		}
+		result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store idempotency key"})
+			c.Abort()
+			return
+		}
+
+		if result.RowsAffected == 0 {
+			var existing models.IdempotencyKey
+			if err := config.DB.Where("key = ? AND scope = ?", key, scope).First(&existing).Error; err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is in progress"})
+				c.Abort()
+				return
+			}
+			replayIdempotentResponse(c, existing, requestHash)
+			return
+		}
+
+		// A panicking handler never answers; free the key so the retry can run
+		defer func() {
+			if r := recover(); r != nil {
+				config.DB.Delete(&record)
+				panic(r)
+			}
+		}()
+
+		recorder := &idempotencyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			// Let the client retry failed requests with the same key
+			config.DB.Delete(&record)
+			return
+		}
+
+		if err := config.DB.Model(&record).Updates(map[string]interface{}{
+			"status_code":   status,
+			"response_body": recorder.body.String(),
+		}).Error; err != nil {
+			log.Printf("Failed to store response for Idempotency-Key %s: %v", key, err)
+		}
+	}
+}
+
+// guestScope identifies a guest client so that guests cannot replay each
+// other's keys: by its cart token when it has one, else by address and browser
+func guestScope(c *gin.Context) string {
+	client := c.GetHeader("X-Cart-Token")
+	if client == "" {
+		client, _ = c.Cookie("cart_token")
+	}
+	if client == "" {
+		client = c.ClientIP() + "\n" + c.Request.UserAgent()
+	}
+	hash := sha256.Sum256([]byte(client))
+	return "guest:" + hex.EncodeToString(hash[:16])
+}
+
+// replayIdempotentResponse answers a retry from a stored idempotency record
+func replayIdempotentResponse(c *gin.Context, existing models.IdempotencyKey, requestHash string) {
+	defer c.Abort()
+
+	if existing.RequestHash != requestHash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+		return
+	}
+	if existing.StatusCode == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is in progress"})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(existing.StatusCode, "application/json; charset=utf-8", []byte(existing.ResponseBody))
+}
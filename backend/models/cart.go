@@ -7,16 +7,19 @@ import (
 	"gorm.io/gorm"
 )
 
-// CartItem represents an item in user's cart
+// CartItem represents an item in a user's cart, or in a guest cart identified
+// by an opaque cart token
 type CartItem struct {
-	ID        uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
-	UserID    uuid.UUID      `gorm:"type:uuid;not null" json:"user_id"`
-	ProductID uuid.UUID      `gorm:"type:uuid;not null" json:"product_id"`
-	VariantID *uuid.UUID     `gorm:"type:uuid" json:"variant_id,omitempty"`
-	Quantity  int            `gorm:"not null;default:1" json:"quantity"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	UserID     *uuid.UUID     `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	CartToken  string         `gorm:"index" json:"-"`
+	ProductID  uuid.UUID      `gorm:"type:uuid;not null" json:"product_id"`
+	VariantID  *uuid.UUID     `gorm:"type:uuid" json:"variant_id,omitempty"`
+	Quantity   int            `gorm:"not null;default:1" json:"quantity"`
+	AddedPrice float64        `gorm:"default:0" json:"added_price"` // unit price when added
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
 
 	Product Product         `gorm:"foreignKey:ProductID" json:"product,omitempty"`
 	Variant *ProductVariant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CartRecoveryStatus represents where an abandoned cart email stands
+type CartRecoveryStatus string
+
+const (
+	CartRecoverySent      CartRecoveryStatus = "sent"
+	CartRecoveryFailed    CartRecoveryStatus = "failed" // only on older rows; the email outbox tracks sends
+	CartRecoveryConverted CartRecoveryStatus = "converted"
+)
+
+// CartRecoveryItem is a cart line as it was when the recovery email was sent
+type CartRecoveryItem struct {
+	ProductID uuid.UUID  `json:"product_id"`
+	VariantID *uuid.UUID `json:"variant_id,omitempty"`
+	Quantity  int        `json:"quantity"`
+	Price     float64    `json:"price"`
+}
+
+// CartRecovery records an abandoned cart email and what the customer did with it
+type CartRecovery struct {
+	ID           uuid.UUID          `gorm:"type:uuid;primary_key" json:"id"`
+	UserID       uuid.UUID          `gorm:"type:uuid;not null;index;uniqueIndex:idx_cart_recovery_state" json:"user_id"`
+	Email        string             `gorm:"not null" json:"email"`
+	Status       CartRecoveryStatus `gorm:"default:sent;index" json:"status"`
+	Items        []CartRecoveryItem `gorm:"type:text;serializer:json" json:"items"`
+	CartValue    float64            `json:"cart_value"`
+	LastActivity time.Time          `gorm:"uniqueIndex:idx_cart_recovery_state" json:"last_activity"` // when the cart was last touched; one email per cart state
+	Error        string             `gorm:"type:text" json:"error,omitempty"`
+	SentAt       *time.Time         `json:"sent_at,omitempty"`
+	OpenedAt     *time.Time         `json:"opened_at,omitempty"`
+	ClickedAt    *time.Time         `json:"clicked_at,omitempty"`
+	ConvertedAt  *time.Time         `json:"converted_at,omitempty"`
+	OrderID      *uuid.UUID         `gorm:"type:uuid" json:"order_id,omitempty"`
+	CreatedAt    time.Time          `json:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
+
+	User  *User  `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Order *Order `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+}
+
+func (r *CartRecovery) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CouponType represents how a coupon discounts an order
+type CouponType string
+
+const (
+	CouponTypePercentage   CouponType = "percentage"
+	CouponTypeFixed        CouponType = "fixed"
+	CouponTypeFreeShipping CouponType = "free_shipping"
+)
+
+// Coupon represents a promotion code that can be applied at checkout
+type Coupon struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	Code        string     `gorm:"uniqueIndex;not null" json:"code"` // stored upper case
+	Description string     `json:"description"`
+	Type        CouponType `gorm:"not null" json:"type"`
+	Value       float64    `gorm:"default:0" json:"value"`        // percent (0-100) or fixed IDR amount
+	MaxDiscount float64    `gorm:"default:0" json:"max_discount"` // cap for percentage coupons, 0 = no cap
+	MinSpend    float64    `gorm:"default:0" json:"min_spend"`
+
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+
+	UsageLimit   int  `gorm:"default:0" json:"usage_limit"`    // 0 = unlimited
+	UsageCount   int  `gorm:"default:0" json:"usage_count"`    // orders that currently hold the coupon
+	PerUserLimit int  `gorm:"default:0" json:"per_user_limit"` // 0 = unlimited
+	IsActive     bool `gorm:"default:true" json:"is_active"`
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Scope: when both are empty the coupon applies to every product
+	Categories []Category `gorm:"many2many:coupon_categories" json:"categories,omitempty"`
+	Products   []Product  `gorm:"many2many:coupon_products" json:"products,omitempty"`
+}
+
+func (c *Coupon) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// CouponRedemption records a coupon used by an order
+type CouponRedemption struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CouponID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"coupon_id"`
+	OrderID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"order_id"`
+	UserID     *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	GuestEmail string     `gorm:"index" json:"guest_email,omitempty"`
+	Discount   float64    `gorm:"not null" json:"discount"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (cr *CouponRedemption) BeforeCreate(tx *gorm.DB) error {
+	if cr.ID == uuid.Nil {
+		cr.ID = uuid.New()
+	}
+	return nil
+}
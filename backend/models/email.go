@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EmailStatus represents where a queued email stands
+type EmailStatus string
+
+const (
+	EmailStatusPending EmailStatus = "pending"
+	EmailStatusSent    EmailStatus = "sent"
+	EmailStatusFailed  EmailStatus = "failed" // gave up after the last retry
+)
+
+// OutboundEmail is an email queued in the outbox. It is written in the same
+// transaction as the change it reports and sent later by the outbox job.
+type OutboundEmail struct {
+	ID            uuid.UUID   `gorm:"type:uuid;primary_key" json:"id"`
+	Kind          string      `gorm:"not null;index" json:"kind"`
+	To            string      `gorm:"not null" json:"to"`
+	Subject       string      `gorm:"not null" json:"subject"`
+	Text          string      `gorm:"type:text" json:"text"`
+	HTML          string      `gorm:"type:text" json:"html,omitempty"`
+	Status        EmailStatus `gorm:"default:pending;index" json:"status"`
+	Attempts      int         `gorm:"default:0" json:"attempts"`
+	NextAttemptAt time.Time   `gorm:"index" json:"next_attempt_at"`
+	LastError     string      `gorm:"type:text" json:"last_error,omitempty"`
+	SentAt        *time.Time  `json:"sent_at,omitempty"`
+	OrderID       *uuid.UUID  `gorm:"type:uuid;index" json:"order_id,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+func (e *OutboundEmail) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
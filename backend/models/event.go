@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EventStatus represents where a domain event stands in the outbox
+type EventStatus string
+
+const (
+	EventStatusPending   EventStatus = "pending"
+	EventStatusDelivered EventStatus = "delivered" // every subscriber handled it
+	EventStatusFailed    EventStatus = "failed"    // gave up after the last retry
+)
+
+// DomainEvent is something that happened to an order, product or user. It is
+// written in the same transaction as the change and delivered to subscribers
+// afterwards by the event dispatcher.
+type DomainEvent struct {
+	ID            uuid.UUID   `gorm:"type:uuid;primary_key" json:"id"`
+	Type          string      `gorm:"not null;index" json:"type"`
+	AggregateID   uuid.UUID   `gorm:"type:uuid;index" json:"aggregate_id"` // the order, product or user it is about
+	Payload       string      `gorm:"type:text" json:"payload"`
+	Status        EventStatus `gorm:"default:pending;index" json:"status"`
+	Attempts      int         `gorm:"default:0" json:"attempts"`
+	NextAttemptAt time.Time   `gorm:"index" json:"next_attempt_at"`
+	Delivered     []string    `gorm:"type:text;serializer:json" json:"delivered"` // subscribers that handled it
+	LastError     string      `gorm:"type:text" json:"last_error,omitempty"`
+	DeliveredAt   *time.Time  `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+func (e *DomainEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
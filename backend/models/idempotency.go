@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey stores the outcome of a request made with an Idempotency-Key
+// header so that retries can be answered with the original response
+type IdempotencyKey struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	Key          string    `gorm:"not null;uniqueIndex:idx_idempotency_scope_key" json:"key"`
+	Scope        string    `gorm:"not null;uniqueIndex:idx_idempotency_scope_key" json:"scope"` // user ID or "guest:" and a client hash, plus route
+	RequestHash  string    `gorm:"not null" json:"request_hash"`
+	StatusCode   int       `gorm:"default:0" json:"status_code"` // 0 while the request is in flight
+	ResponseBody string    `gorm:"type:text" json:"response_body"`
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (k *IdempotencyKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
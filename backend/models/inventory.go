@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StockMovementReason explains why stock changed
+type StockMovementReason string
+
+const (
+	StockReasonOrderReserved   StockMovementReason = "order_reserved"
+	StockReasonOrderCancelled  StockMovementReason = "order_cancelled"
+	StockReasonPaymentExpired  StockMovementReason = "payment_expired"
+	StockReasonAdminAdjustment StockMovementReason = "admin_adjustment"
+	StockReasonRestock         StockMovementReason = "restock"
+	StockReasonReturnRestocked StockMovementReason = "return_restocked"
+)
+
+// StockMovement is an append-only ledger entry for a change to product or
+// variant stock. A movement with a variant changes both the variant and its
+// product, since product stock is the total across its variants.
+type StockMovement struct {
+	ID          uuid.UUID           `gorm:"type:uuid;primary_key" json:"id"`
+	ProductID   uuid.UUID           `gorm:"type:uuid;not null;index" json:"product_id"`
+	VariantID   *uuid.UUID          `gorm:"type:uuid;index" json:"variant_id,omitempty"`
+	Delta       int                 `gorm:"not null" json:"delta"`
+	Reason      StockMovementReason `gorm:"not null" json:"reason"`
+	ReferenceID *uuid.UUID          `gorm:"type:uuid;index" json:"reference_id,omitempty"` // e.g. the order
+	ActorID     *uuid.UUID          `gorm:"type:uuid" json:"actor_id,omitempty"`
+	ActorRole   string              `gorm:"not null" json:"actor_role"`
+	Note        string              `json:"note,omitempty"`
+	CreatedAt   time.Time           `gorm:"index" json:"created_at"`
+}
+
+func (m *StockMovement) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
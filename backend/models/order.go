@@ -19,6 +19,32 @@ const (
 	OrderStatusCancelled  OrderStatus = "cancelled"
 )
 
+// orderTransitions lists the statuses each order status may move to
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:    {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:       {OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusProcessing: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:    {OrderStatusDelivered},
+	OrderStatusDelivered:  {},
+	OrderStatusCancelled:  {},
+}
+
+// IsValid reports whether s is one of the known order statuses
+func (s OrderStatus) IsValid() bool {
+	_, ok := orderTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether an order in status s may move to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 // Order represents a customer order
 type Order struct {
 	ID          uuid.UUID   `gorm:"type:uuid;primary_key" json:"id"`
@@ -28,19 +54,28 @@ type Order struct {
 	Status      OrderStatus `gorm:"default:pending" json:"status"`
 	Subtotal    float64     `gorm:"not null" json:"subtotal"`
 	ShippingFee float64     `gorm:"default:0" json:"shipping_fee"`
+	Discount    float64     `gorm:"default:0" json:"discount"`
+	CouponCode  string      `json:"coupon_code,omitempty"`
 	Total       float64     `gorm:"not null" json:"total"`
 	Notes       string      `json:"notes"`
 
 	// Shipping info
-	TrackingNumber string     `json:"tracking_number,omitempty"`
-	ShippedAt      *time.Time `json:"shipped_at,omitempty"`
-	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	Courier           string     `json:"courier,omitempty"`                // courier code, see services.SupportedCouriers
+	ShippingWeight    int        `gorm:"default:0" json:"shipping_weight"` // grams
+	TrackingNumber    string     `json:"tracking_number,omitempty"`
+	TrackingStatus    string     `json:"tracking_status,omitempty"` // latest normalized courier status
+	TrackingCheckedAt *time.Time `json:"tracking_checked_at,omitempty"`
+	ShippedAt         *time.Time `json:"shipped_at,omitempty"`
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty"`
 
 	// Guest checkout fields
-	GuestEmail   string `json:"guest_email,omitempty"`
-	GuestName    string `json:"guest_name,omitempty"`
-	GuestPhone   string `json:"guest_phone,omitempty"`
-	GuestAddress string `json:"guest_address,omitempty"`
+	GuestEmail      string `json:"guest_email,omitempty"`
+	GuestName       string `json:"guest_name,omitempty"`
+	GuestPhone      string `json:"guest_phone,omitempty"`
+	GuestAddress    string `json:"guest_address,omitempty"`
+	GuestCity       string `json:"guest_city,omitempty"`
+	GuestState      string `json:"guest_state,omitempty"`
+	GuestPostalCode string `json:"guest_postal_code,omitempty"`
 
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
@@ -51,6 +86,10 @@ type Order struct {
 	Address *Address    `gorm:"foreignKey:AddressID" json:"address,omitempty"`
 	Items   []OrderItem `gorm:"foreignKey:OrderID" json:"items,omitempty"`
 	Payment *Payment    `gorm:"foreignKey:OrderID" json:"payment,omitempty"`
+
+	StatusHistory  []OrderStatusHistory `gorm:"foreignKey:OrderID" json:"status_history,omitempty"`
+	ShipmentEvents []ShipmentEvent      `gorm:"foreignKey:OrderID" json:"shipment_events,omitempty"`
+	Returns        []ReturnRequest      `gorm:"foreignKey:OrderID" json:"returns,omitempty"`
 }
 
 func (o *Order) BeforeCreate(tx *gorm.DB) error {
@@ -84,6 +123,25 @@ func (oi *OrderItem) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// OrderStatusHistory records a single status change of an order
+type OrderStatusHistory struct {
+	ID         uuid.UUID   `gorm:"type:uuid;primary_key" json:"id"`
+	OrderID    uuid.UUID   `gorm:"type:uuid;not null;index" json:"order_id"`
+	FromStatus OrderStatus `json:"from_status"` // empty for the initial status
+	ToStatus   OrderStatus `gorm:"not null" json:"to_status"`
+	ActorID    *uuid.UUID  `gorm:"type:uuid" json:"actor_id,omitempty"`
+	ActorRole  string      `gorm:"not null" json:"actor_role"` // customer, admin, guest, system
+	Reason     string      `json:"reason"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+func (h *OrderStatusHistory) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
+
 // PaymentStatus represents the status of a payment
 type PaymentStatus string
 
@@ -92,6 +150,9 @@ const (
 	PaymentStatusSuccess PaymentStatus = "success"
 	PaymentStatusFailed  PaymentStatus = "failed"
 	PaymentStatusExpired PaymentStatus = "expired"
+
+	PaymentStatusRefunded          PaymentStatus = "refunded"
+	PaymentStatusPartiallyRefunded PaymentStatus = "partially_refunded"
 )
 
 // Payment represents a payment for an order
@@ -108,6 +169,9 @@ type Payment struct {
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	RefundedAmount float64  `gorm:"default:0" json:"refunded_amount"`
+	Refunds        []Refund `gorm:"foreignKey:PaymentID" json:"refunds,omitempty"`
 }
 
 func (p *Payment) BeforeCreate(tx *gorm.DB) error {
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NotificationOutcome records what happened to a payment gateway notification
+type NotificationOutcome string
+
+const (
+	NotificationReceived  NotificationOutcome = "received"
+	NotificationApplied   NotificationOutcome = "applied"
+	NotificationDuplicate NotificationOutcome = "duplicate"
+	NotificationIgnored   NotificationOutcome = "ignored"
+	NotificationRejected  NotificationOutcome = "rejected"
+	NotificationFailed    NotificationOutcome = "failed"
+)
+
+// PaymentNotification stores every transaction update received from the payment
+// gateway, raw, for replay and debugging
+type PaymentNotification struct {
+	ID                uuid.UUID           `gorm:"type:uuid;primary_key" json:"id"`
+	Source            string              `gorm:"not null" json:"source"`
+	Reference         string              `gorm:"index" json:"reference"`
+	TransactionID     string              `json:"transaction_id"`
+	TransactionStatus string              `json:"transaction_status"`
+	FraudStatus       string              `json:"fraud_status,omitempty"`
+	GrossAmount       string              `json:"gross_amount"`
+	IdempotencyKey    string              `gorm:"index" json:"idempotency_key"`
+	Payload           string              `gorm:"type:text" json:"payload"`
+	Outcome           NotificationOutcome `gorm:"default:received;index" json:"outcome"`
+	Detail            string              `gorm:"type:text" json:"detail,omitempty"`
+	PaymentID         *uuid.UUID          `gorm:"type:uuid;index" json:"payment_id,omitempty"`
+	ProcessedAt       *time.Time          `json:"processed_at,omitempty"`
+	CreatedAt         time.Time           `json:"created_at"`
+}
+
+func (n *PaymentNotification) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
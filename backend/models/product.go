@@ -36,6 +36,7 @@ type Product struct {
 	BasePrice   float64        `gorm:"not null" json:"base_price"`
 	CategoryID  uuid.UUID      `gorm:"type:uuid" json:"category_id"`
 	Stock       int            `gorm:"default:0" json:"stock"`
+	Weight      int            `gorm:"default:0" json:"weight"` // grams
 	IsActive    bool           `gorm:"default:true" json:"is_active"`
 	IsFeatured  bool           `gorm:"default:false" json:"is_featured"`
 	CreatedAt   time.Time      `json:"created_at"`
@@ -82,6 +83,7 @@ type ProductVariant struct {
 	Value         string         `gorm:"not null" json:"value"` // e.g., "XL", "Red"
 	PriceModifier float64        `gorm:"default:0" json:"price_modifier"`
 	Stock         int            `gorm:"default:0" json:"stock"`
+	Weight        int            `gorm:"default:0" json:"weight"` // grams, 0 = product weight
 	SKU           string         `json:"sku"`
 	CreatedAt     time.Time      `json:"created_at"`
 	UpdatedAt     time.Time      `json:"updated_at"`
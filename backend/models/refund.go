@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefundStatus represents the status of a refund at the payment gateway
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "pending"
+	RefundStatusSucceeded RefundStatus = "succeeded"
+	RefundStatusFailed    RefundStatus = "failed"
+)
+
+// Refund represents money returned to the customer for a payment
+type Refund struct {
+	ID                uuid.UUID    `gorm:"type:uuid;primary_key" json:"id"`
+	PaymentID         uuid.UUID    `gorm:"type:uuid;not null;index" json:"payment_id"`
+	OrderID           uuid.UUID    `gorm:"type:uuid;not null;index" json:"order_id"`
+	Amount            float64      `gorm:"not null" json:"amount"`
+	Reason            string       `json:"reason"`
+	Status            RefundStatus `gorm:"default:pending" json:"status"`
+	RefundKey         string       `gorm:"uniqueIndex;not null" json:"refund_key"` // sent to the gateway, makes retries safe
+	ProviderReference string       `json:"provider_reference,omitempty"`
+	FailureReason     string       `json:"failure_reason,omitempty"`
+	ActorID           *uuid.UUID   `gorm:"type:uuid" json:"actor_id,omitempty"`
+	ActorRole         string       `json:"actor_role"`
+	CompletedAt       *time.Time   `json:"completed_at,omitempty"`
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+}
+
+func (r *Refund) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ReturnStatus represents the status of a return request
+type ReturnStatus string
+
+const (
+	ReturnStatusRequested ReturnStatus = "requested"
+	ReturnStatusApproved  ReturnStatus = "approved"
+	ReturnStatusRejected  ReturnStatus = "rejected"
+	ReturnStatusCancelled ReturnStatus = "cancelled"
+	ReturnStatusReceived  ReturnStatus = "received"
+	ReturnStatusCompleted ReturnStatus = "completed"
+)
+
+// returnTransitions lists the statuses each return status may move to
+var returnTransitions = map[ReturnStatus][]ReturnStatus{
+	ReturnStatusRequested: {ReturnStatusApproved, ReturnStatusRejected, ReturnStatusCancelled},
+	ReturnStatusApproved:  {ReturnStatusReceived, ReturnStatusCancelled},
+	ReturnStatusReceived:  {ReturnStatusCompleted},
+	ReturnStatusRejected:  {},
+	ReturnStatusCancelled: {},
+	ReturnStatusCompleted: {},
+}
+
+// IsOpen reports whether the return still holds its items against further returns
+func (s ReturnStatus) IsOpen() bool {
+	return s != ReturnStatusRejected && s != ReturnStatusCancelled
+}
+
+// CanTransitionTo reports whether a return may move from s to next
+func (s ReturnStatus) CanTransitionTo(next ReturnStatus) bool {
+	for _, allowed := range returnTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ReturnRequest represents a customer's request to send back delivered items
+type ReturnRequest struct {
+	ID         uuid.UUID    `gorm:"type:uuid;primary_key" json:"id"`
+	OrderID    uuid.UUID    `gorm:"type:uuid;not null;index" json:"order_id"`
+	UserID     *uuid.UUID   `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	Status     ReturnStatus `gorm:"default:requested;index" json:"status"`
+	Reason     string       `gorm:"type:text;not null" json:"reason"`
+	PhotoURLs  []string     `gorm:"type:text;serializer:json" json:"photo_urls"`
+	AdminNote  string       `gorm:"type:text" json:"admin_note,omitempty"`
+	Restocked  bool         `gorm:"default:false" json:"restocked"`
+	RefundID   *uuid.UUID   `gorm:"type:uuid" json:"refund_id,omitempty"`
+	ReceivedAt *time.Time   `json:"received_at,omitempty"`
+	ResolvedAt *time.Time   `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+
+	// Relations
+	Order   *Order                `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+	Items   []ReturnItem          `gorm:"foreignKey:ReturnID" json:"items,omitempty"`
+	History []ReturnStatusHistory `gorm:"foreignKey:ReturnID" json:"history,omitempty"`
+	Refund  *Refund               `gorm:"foreignKey:RefundID" json:"refund,omitempty"`
+}
+
+func (r *ReturnRequest) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// ReturnItem is a quantity of one order item being returned
+type ReturnItem struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	ReturnID    uuid.UUID `gorm:"type:uuid;not null;index" json:"return_id"`
+	OrderItemID uuid.UUID `gorm:"type:uuid;not null;index" json:"order_item_id"`
+	Quantity    int       `gorm:"not null" json:"quantity"`
+
+	OrderItem OrderItem `gorm:"foreignKey:OrderItemID" json:"order_item,omitempty"`
+}
+
+func (ri *ReturnItem) BeforeCreate(tx *gorm.DB) error {
+	if ri.ID == uuid.Nil {
+		ri.ID = uuid.New()
+	}
+	return nil
+}
+
+// ReturnStatusHistory records every status change of a return request
+type ReturnStatusHistory struct {
+	ID         uuid.UUID    `gorm:"type:uuid;primary_key" json:"id"`
+	ReturnID   uuid.UUID    `gorm:"type:uuid;not null;index" json:"return_id"`
+	FromStatus ReturnStatus `json:"from_status,omitempty"`
+	ToStatus   ReturnStatus `gorm:"not null" json:"to_status"`
+	ActorID    *uuid.UUID   `gorm:"type:uuid" json:"actor_id,omitempty"`
+	ActorRole  string       `json:"actor_role"`
+	Note       string       `json:"note,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+func (h *ReturnStatusHistory) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ShippingZone groups destinations that share the same rate table
+type ShippingZone struct {
+	ID              uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	Name            string         `gorm:"not null" json:"name"`
+	IsDefault       bool           `gorm:"default:false" json:"is_default"`    // used when no region matches
+	FreeShippingMin float64        `gorm:"default:0" json:"free_shipping_min"` // subtotal above which shipping is free, 0 = never
+	IsActive        bool           `gorm:"default:true" json:"is_active"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Regions []ShippingZoneRegion `gorm:"foreignKey:ZoneID" json:"regions,omitempty"`
+	Rates   []ShippingRate       `gorm:"foreignKey:ZoneID" json:"rates,omitempty"`
+}
+
+func (z *ShippingZone) BeforeCreate(tx *gorm.DB) error {
+	if z.ID == uuid.Nil {
+		z.ID = uuid.New()
+	}
+	return nil
+}
+
+// ShippingZoneRegion matches destinations to a zone. Empty fields match anything;
+// the most specific matching region (postal code, then city, then state) wins.
+type ShippingZoneRegion struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	ZoneID       uuid.UUID `gorm:"type:uuid;not null;index" json:"zone_id"`
+	State        string    `json:"state"`
+	City         string    `json:"city"`
+	PostalPrefix string    `json:"postal_prefix"`
+}
+
+func (r *ShippingZoneRegion) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// ShippingRate is a weight band of a zone's rate table. Weights are in grams.
+type ShippingRate struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	ZoneID    uuid.UUID `gorm:"type:uuid;not null;index" json:"zone_id"`
+	MinWeight int       `gorm:"default:0" json:"min_weight"`
+	MaxWeight int       `gorm:"default:0" json:"max_weight"` // exclusive, 0 = no upper bound
+	Fee       float64   `gorm:"not null" json:"fee"`
+	PerKgFee  float64   `gorm:"default:0" json:"per_kg_fee"` // added for every started kg above MinWeight
+}
+
+func (r *ShippingRate) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// ShippingCourier is a courier customers can choose at checkout
+type ShippingCourier struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	Code       string         `gorm:"uniqueIndex;not null" json:"code"`
+	Name       string         `gorm:"not null" json:"name"`
+	Multiplier float64        `gorm:"default:1" json:"multiplier"` // applied to the zone rate
+	IsActive   bool           `gorm:"default:true" json:"is_active"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (sc *ShippingCourier) BeforeCreate(tx *gorm.DB) error {
+	if sc.ID == uuid.Nil {
+		sc.ID = uuid.New()
+	}
+	return nil
+}
+
+// ShipmentEvent is a courier tracking event recorded against an order
+type ShipmentEvent struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	OrderID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_shipment_event" json:"order_id"`
+	Time        time.Time `gorm:"not null;uniqueIndex:idx_shipment_event" json:"time"`
+	Status      string    `json:"status"`
+	Description string    `gorm:"uniqueIndex:idx_shipment_event" json:"description"`
+	Location    string    `json:"location"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (se *ShipmentEvent) BeforeCreate(tx *gorm.DB) error {
+	if se.ID == uuid.Nil {
+		se.ID = uuid.New()
+	}
+	return nil
+}
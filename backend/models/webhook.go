@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebhookSubscription is an integrator endpoint that receives signed event
+// payloads for the event types it subscribed to
+type WebhookSubscription struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	URL         string    `gorm:"not null" json:"url"`
+	Secret      string    `gorm:"not null" json:"-"` // HMAC-SHA256 signing key
+	Events      []string  `gorm:"type:text;serializer:json" json:"events"`
+	Description string    `json:"description"`
+	IsActive    bool      `gorm:"default:true" json:"is_active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (s *WebhookSubscription) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// WebhookDeliveryStatus represents where a webhook delivery stands
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed" // gave up after the last retry
+)
+
+// WebhookDelivery is one event to be sent to one subscription
+type WebhookDelivery struct {
+	ID             uuid.UUID             `gorm:"type:uuid;primary_key" json:"id"`
+	SubscriptionID uuid.UUID             `gorm:"type:uuid;not null;uniqueIndex:idx_webhook_delivery_event" json:"subscription_id"`
+	EventID        uuid.UUID             `gorm:"type:uuid;not null;uniqueIndex:idx_webhook_delivery_event" json:"event_id"` // the domain event
+	EventType      string                `gorm:"not null;index" json:"event_type"`
+	Payload        string                `gorm:"type:text" json:"payload"`
+	Status         WebhookDeliveryStatus `gorm:"default:pending;index" json:"status"`
+	Attempts       int                   `gorm:"default:0" json:"attempts"`
+	NextAttemptAt  time.Time             `gorm:"index" json:"next_attempt_at"`
+	ResponseStatus int                   `json:"response_status,omitempty"` // of the last attempt
+	LastError      string                `gorm:"type:text" json:"last_error,omitempty"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+
+	Subscription *WebhookSubscription     `gorm:"foreignKey:SubscriptionID" json:"subscription,omitempty"`
+	Log          []WebhookDeliveryAttempt `gorm:"foreignKey:DeliveryID" json:"log,omitempty"`
+}
+
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+// WebhookDeliveryAttempt records one HTTP request made for a delivery
+type WebhookDeliveryAttempt struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	DeliveryID     uuid.UUID `gorm:"type:uuid;not null;index" json:"delivery_id"`
+	ResponseStatus int       `json:"response_status,omitempty"` // 0 when no response arrived
+	ResponseBody   string    `gorm:"type:text" json:"response_body,omitempty"`
+	Error          string    `gorm:"type:text" json:"error,omitempty"`
+	DurationMs     int64     `json:"duration_ms"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (a *WebhookDeliveryAttempt) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
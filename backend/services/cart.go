@@ -0,0 +1,242 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NewCartToken returns a random opaque token identifying a guest cart
+func NewCartToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Warnings GetCart reports for items that changed since they were added
+const (
+	CartWarningUnavailable     = "unavailable"
+	CartWarningOutOfStock      = "out_of_stock"
+	CartWarningQuantityReduced = "quantity_reduced"
+	CartWarningPriceChanged    = "price_changed"
+)
+
+// CartWarning tells the customer about one cart item that changed
+type CartWarning struct {
+	ItemID    uuid.UUID `json:"item_id"`
+	Code      string    `json:"code"`
+	Message   string    `json:"message"`
+	Available *int      `json:"available,omitempty"`
+	OldPrice  float64   `json:"old_price,omitempty"`
+	NewPrice  float64   `json:"new_price,omitempty"`
+}
+
+// PreloadCartItems loads the products and variants of cart items, including
+// ones deleted since, so they can be reported as unavailable
+func PreloadCartItems(db *gorm.DB) *gorm.DB {
+	unscoped := func(db *gorm.DB) *gorm.DB { return db.Unscoped() }
+	return db.Preload("Product", unscoped).Preload("Product.Images").Preload("Variant", unscoped)
+}
+
+// UnitPrice returns the current price of one product, or product variant
+func UnitPrice(product models.Product, variant *models.ProductVariant) float64 {
+	price := product.BasePrice
+	if variant != nil {
+		price += variant.PriceModifier
+	}
+	return price
+}
+
+// AvailableStock returns how many of a product, or product variant, can be ordered
+func AvailableStock(product models.Product, variant *models.ProductVariant) int {
+	if variant != nil {
+		return variant.Stock
+	}
+	return product.Stock
+}
+
+// CartItemAvailable reports whether a cart item's product and variant can still be bought
+func CartItemAvailable(item models.CartItem) bool {
+	if item.Product.ID == uuid.Nil || item.Product.DeletedAt.Valid || !item.Product.IsActive {
+		return false
+	}
+	if item.VariantID != nil && (item.Variant == nil || item.Variant.DeletedAt.Valid) {
+		return false
+	}
+	return true
+}
+
+// ValidateCart compares cart items (loaded with PreloadCartItems) with the
+// current catalog. Quantities above the stock left are reduced, which is
+// reported once. A price change is reported until the customer accepts it
+// with AcceptCartPrices or adds the item again; items that are unavailable or
+// out of stock stay in the cart until removed. Nothing here touches
+// updated_at, so looking at a cart is not cart activity.
+func ValidateCart(db *gorm.DB, items []models.CartItem) ([]CartWarning, error) {
+	warnings := []CartWarning{}
+
+	for i := range items {
+		item := &items[i]
+		if !CartItemAvailable(*item) {
+			warnings = append(warnings, CartWarning{
+				ItemID:  item.ID,
+				Code:    CartWarningUnavailable,
+				Message: fmt.Sprintf("%s is no longer available", cartItemName(*item)),
+			})
+			continue
+		}
+
+		available := AvailableStock(item.Product, item.Variant)
+		switch {
+		case available <= 0:
+			zero := 0
+			warnings = append(warnings, CartWarning{
+				ItemID:    item.ID,
+				Code:      CartWarningOutOfStock,
+				Message:   fmt.Sprintf("%s is out of stock", cartItemName(*item)),
+				Available: &zero,
+			})
+		case item.Quantity > available:
+			warnings = append(warnings, CartWarning{
+				ItemID:    item.ID,
+				Code:      CartWarningQuantityReduced,
+				Message:   fmt.Sprintf("Only %d of %s left; quantity reduced from %d", available, cartItemName(*item), item.Quantity),
+				Available: &available,
+			})
+			item.Quantity = available
+			if err := db.Model(&models.CartItem{}).Where("id = ?", item.ID).UpdateColumn("quantity", available).Error; err != nil {
+				return nil, err
+			}
+		}
+
+		price := UnitPrice(item.Product, item.Variant)
+		if item.AddedPrice > 0 && math.Abs(price-item.AddedPrice) >= 0.01 {
+			warnings = append(warnings, CartWarning{
+				ItemID:   item.ID,
+				Code:     CartWarningPriceChanged,
+				Message:  fmt.Sprintf("The price of %s changed from %.0f to %.0f", cartItemName(*item), item.AddedPrice, price),
+				OldPrice: item.AddedPrice,
+				NewPrice: price,
+			})
+		}
+	}
+
+	return warnings, nil
+}
+
+// AcceptCartPrices records the current price of each cart item (loaded with
+// PreloadCartItems) as the price the customer agreed to, which clears their
+// price change warnings
+func AcceptCartPrices(db *gorm.DB, items []models.CartItem) error {
+	for i := range items {
+		item := &items[i]
+		if !CartItemAvailable(*item) {
+			continue
+		}
+		price := UnitPrice(item.Product, item.Variant)
+		if item.AddedPrice == price {
+			continue
+		}
+		if err := db.Model(&models.CartItem{}).Where("id = ?", item.ID).Update("added_price", price).Error; err != nil {
+			return err
+		}
+		item.AddedPrice = price
+	}
+	return nil
+}
+
+// cartItemName names a cart item in warnings
+func cartItemName(item models.CartItem) string {
+	name := item.Product.Name
+	if name == "" {
+		name = "A product"
+	}
+	if item.Variant != nil {
+		name += " (" + item.Variant.Name + ": " + item.Variant.Value + ")"
+	}
+	return name
+}
+
+// CartLines prices cart items (with Product and Variant loaded) as order lines
+func CartLines(items []models.CartItem) []CheckoutLine {
+	lines := make([]CheckoutLine, 0, len(items))
+	for _, item := range items {
+		price := UnitPrice(item.Product, item.Variant)
+		variantInfo := ""
+		if item.Variant != nil {
+			variantInfo = item.Variant.Name + ": " + item.Variant.Value
+		}
+
+		lines = append(lines, CheckoutLine{
+			Item: models.OrderItem{
+				ProductID:   item.ProductID,
+				VariantID:   item.VariantID,
+				ProductName: item.Product.Name,
+				VariantInfo: variantInfo,
+				Price:       price,
+				Quantity:    item.Quantity,
+				Subtotal:    price * float64(item.Quantity),
+			},
+			CategoryID: item.Product.CategoryID,
+			Weight:     ItemWeight(item.Product, item.Variant),
+		})
+	}
+	return lines
+}
+
+// MergeGuestCart moves the items of a guest cart into a user's cart. Where the
+// user already has the same product and variant the quantities are added up.
+// It returns how many guest items were merged.
+func MergeGuestCart(db *gorm.DB, token string, userID uuid.UUID) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	merged := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var guestItems []models.CartItem
+		if err := tx.Where("cart_token = ? AND user_id IS NULL", token).Find(&guestItems).Error; err != nil {
+			return err
+		}
+
+		for _, guestItem := range guestItems {
+			query := tx.Where("user_id = ? AND product_id = ?", userID, guestItem.ProductID)
+			if guestItem.VariantID != nil {
+				query = query.Where("variant_id = ?", *guestItem.VariantID)
+			} else {
+				query = query.Where("variant_id IS NULL")
+			}
+
+			var existing models.CartItem
+			result := query.Limit(1).Find(&existing)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if result.RowsAffected > 0 {
+				if err := tx.Model(&existing).Update("quantity", gorm.Expr("quantity + ?", guestItem.Quantity)).Error; err != nil {
+					return err
+				}
+				if err := tx.Delete(&guestItem).Error; err != nil {
+					return err
+				}
+			} else if err := tx.Model(&guestItem).Updates(map[string]interface{}{
+				"user_id":    userID,
+				"cart_token": "",
+			}).Error; err != nil {
+				return err
+			}
+			merged++
+		}
+		return nil
+	})
+	return merged, err
+}
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EmailCartRecovery is the kind of abandoned cart emails in the outbox
+const EmailCartRecovery = "cart_recovery"
+
+const (
+	// abandonedCartMaxAge stops carts that were left long ago from being emailed
+	abandonedCartMaxAge = 30 * 24 * time.Hour
+	// cartRecoveryAttribution is how long after the email an order counts as recovered
+	cartRecoveryAttribution = 7 * 24 * time.Hour
+)
+
+// CartRecoveryOptions configures abandoned cart emails
+type CartRecoveryOptions struct {
+	Secret      string // signs the links in the email
+	FrontendURL string
+	APIURL      string
+	IdleFor     time.Duration // how long a cart must be untouched to count as abandoned
+	Limit       int
+}
+
+// SignCartRecovery signs a cart recovery ID for the links in its email
+func SignCartRecovery(id uuid.UUID, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("cart-recovery:" + id.String()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCartRecovery checks a signature made by SignCartRecovery
+func VerifyCartRecovery(id uuid.UUID, signature, secret string) bool {
+	return hmac.Equal([]byte(SignCartRecovery(id, secret)), []byte(signature))
+}
+
+// SendAbandonedCartEmails queues emails to signed in customers whose cart has
+// not been touched for opts.IdleFor and who have not ordered since. Every cart
+// state is emailed at most once, even with several replicas running this;
+// touching the cart again makes it eligible again.
+func SendAbandonedCartEmails(ctx context.Context, db *gorm.DB, opts CartRecoveryOptions) (int, error) {
+	now := time.Now()
+
+	var candidates []struct {
+		UserID       uuid.UUID
+		LastActivity time.Time
+	}
+	if err := db.Model(&models.CartItem{}).
+		Select("cart_items.user_id, MAX(cart_items.updated_at) AS last_activity").
+		Where("cart_items.user_id IS NOT NULL").
+		Group("cart_items.user_id").
+		Having("MAX(cart_items.updated_at) < ? AND MAX(cart_items.updated_at) > ?", now.Add(-opts.IdleFor), now.Add(-abandonedCartMaxAge)).
+		Having("NOT EXISTS (SELECT 1 FROM cart_recoveries WHERE cart_recoveries.user_id = cart_items.user_id AND cart_recoveries.last_activity >= MAX(cart_items.updated_at))").
+		Having("NOT EXISTS (SELECT 1 FROM orders WHERE orders.user_id = cart_items.user_id AND orders.created_at > MAX(cart_items.updated_at))").
+		Order("last_activity asc").Limit(opts.Limit).
+		Scan(&candidates).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, candidate := range candidates {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+
+		ok, err := queueCartRecovery(db, opts, candidate.UserID, candidate.LastActivity)
+		if err != nil {
+			return sent, err
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// queueCartRecovery claims the recovery of one user's cart state and queues
+// its email through the outbox in the same transaction. The claim is the
+// insert of the cart_recoveries row, unique per user and cart state, so a
+// replica that loses the race sends nothing. It reports false when there was
+// nothing worth sending or the cart was already claimed.
+func queueCartRecovery(db *gorm.DB, opts CartRecoveryOptions, userID uuid.UUID, lastActivity time.Time) (bool, error) {
+	var user models.User
+	if err := db.First(&user, "id = ?", userID).Error; err != nil || user.Email == "" {
+		return false, nil
+	}
+
+	var cartItems []models.CartItem
+	if err := db.Scopes(PreloadCartItems).Where("user_id = ?", userID).Find(&cartItems).Error; err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	recovery := models.CartRecovery{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Email:        user.Email,
+		Status:       models.CartRecoverySent,
+		LastActivity: lastActivity,
+		SentAt:       &now,
+	}
+	var lines []cartRecoveryLine
+	for _, item := range cartItems {
+		if !CartItemAvailable(item) || AvailableStock(item.Product, item.Variant) <= 0 {
+			continue
+		}
+		price := UnitPrice(item.Product, item.Variant)
+		recovery.Items = append(recovery.Items, models.CartRecoveryItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			Price:     price,
+		})
+		recovery.CartValue += price * float64(item.Quantity)
+		lines = append(lines, cartRecoveryLine{Name: cartItemName(item), Quantity: item.Quantity, Price: price})
+	}
+	if len(lines) == 0 {
+		return false, nil
+	}
+
+	email, err := cartRecoveryEmail(opts, &recovery, user.Name, lines)
+	if err != nil {
+		log.Printf("Failed to render abandoned cart email to %s: %v", user.Email, err)
+		return false, nil
+	}
+
+	claimed := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&recovery)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		claimed = true
+		return EnqueueEmail(tx, EmailCartRecovery, email, nil)
+	})
+	return claimed, err
+}
+
+// cartRecoveryLine is one cart item as listed in the email
+type cartRecoveryLine struct {
+	Name     string
+	Quantity int
+	Price    float64
+}
+
+var cartRecoveryHTML = template.Must(template.New("cart-recovery").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #111;">
+  <p>Hi {{.Name}},</p>
+  <p>You left these items in your cart:</p>
+  <ul>
+    {{range .Lines}}<li>{{.Quantity}} &times; {{.Name}} &mdash; Rp {{printf "%.0f" .Price}}</li>
+    {{end}}
+  </ul>
+  <p><a href="{{.RestoreURL}}" style="display: inline-block; padding: 10px 20px; background: #111; color: #fff; text-decoration: none; border-radius: 6px;">Back to my cart</a></p>
+  <img src="{{.OpenURL}}" width="1" height="1" alt="">
+</body>
+</html>
+`))
+
+// cartRecoveryEmail renders the recovery email with its signed links
+func cartRecoveryEmail(opts CartRecoveryOptions, recovery *models.CartRecovery, name string, lines []cartRecoveryLine) (Email, error) {
+	signature := SignCartRecovery(recovery.ID, opts.Secret)
+	query := url.Values{"id": {recovery.ID.String()}, "sig": {signature}}
+	restoreURL := strings.TrimSuffix(opts.FrontendURL, "/") + "/cart/recover?" + query.Encode()
+	openURL := strings.TrimSuffix(opts.APIURL, "/") + "/api/cart/recover/" + recovery.ID.String() + "/open?sig=" + signature
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Hi %s,\n\nYou left these items in your cart:\n\n", name)
+	for _, line := range lines {
+		fmt.Fprintf(&text, "- %d x %s (Rp %.0f)\n", line.Quantity, line.Name, line.Price)
+	}
+	fmt.Fprintf(&text, "\nPick up where you left off: %s\n", restoreURL)
+
+	var html bytes.Buffer
+	if err := cartRecoveryHTML.Execute(&html, map[string]interface{}{
+		"Name":       name,
+		"Lines":      lines,
+		"RestoreURL": restoreURL,
+		"OpenURL":    openURL,
+	}); err != nil {
+		return Email{}, err
+	}
+
+	return Email{
+		To:      recovery.Email,
+		Subject: "You left something in your cart",
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// TrackCartRecoveryOpen records the first time a recovery email was opened
+func TrackCartRecoveryOpen(db *gorm.DB, id uuid.UUID) error {
+	return db.Model(&models.CartRecovery{}).Where("id = ? AND opened_at IS NULL", id).
+		Update("opened_at", time.Now()).Error
+}
+
+// RestoreRecoveredCart records the click on a recovery link and puts the
+// emailed items back into a cart: the signed in user's when owner is set,
+// otherwise the guest cart of cartToken. Items already in the cart are left
+// alone, and unavailable ones are skipped. It returns how many items were added.
+func RestoreRecoveredCart(db *gorm.DB, recovery *models.CartRecovery, owner *uuid.UUID, cartToken string) (int, error) {
+	now := time.Now()
+	if err := db.Model(&models.CartRecovery{}).Where("id = ? AND opened_at IS NULL", recovery.ID).
+		Update("opened_at", now).Error; err != nil {
+		return 0, err
+	}
+	if err := db.Model(&models.CartRecovery{}).Where("id = ? AND clicked_at IS NULL", recovery.ID).
+		Update("clicked_at", now).Error; err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, item := range recovery.Items {
+			var product models.Product
+			if err := tx.First(&product, "id = ? AND is_active = ?", item.ProductID, true).Error; err != nil {
+				continue
+			}
+			var variant *models.ProductVariant
+			if item.VariantID != nil {
+				variant = &models.ProductVariant{}
+				if err := tx.First(variant, "id = ? AND product_id = ?", *item.VariantID, item.ProductID).Error; err != nil {
+					continue
+				}
+			}
+			quantity := item.Quantity
+			if available := AvailableStock(product, variant); quantity > available {
+				quantity = available
+			}
+			if quantity <= 0 {
+				continue
+			}
+
+			query := tx.Model(&models.CartItem{}).Where("product_id = ?", item.ProductID)
+			if owner != nil {
+				query = query.Where("user_id = ?", *owner)
+			} else {
+				query = query.Where("cart_token = ? AND user_id IS NULL", cartToken)
+			}
+			if item.VariantID != nil {
+				query = query.Where("variant_id = ?", *item.VariantID)
+			} else {
+				query = query.Where("variant_id IS NULL")
+			}
+			var existing int64
+			if err := query.Count(&existing).Error; err != nil {
+				return err
+			}
+			if existing > 0 {
+				continue
+			}
+
+			// The emailed price is kept so the cart shows any change since
+			cartItem := models.CartItem{
+				UserID:     owner,
+				ProductID:  item.ProductID,
+				VariantID:  item.VariantID,
+				Quantity:   quantity,
+				AddedPrice: item.Price,
+			}
+			if owner == nil {
+				cartItem.CartToken = cartToken
+			}
+			if err := tx.Create(&cartItem).Error; err != nil {
+				return err
+			}
+			restored++
+		}
+		return nil
+	})
+	return restored, err
+}
+
+// MarkCartRecoveryConverted attributes an order to the most recent recovery
+// email sent to its customer within the attribution window, if any
+func MarkCartRecoveryConverted(db *gorm.DB, order *models.Order) error {
+	if order.UserID == nil {
+		return nil
+	}
+
+	var recovery models.CartRecovery
+	result := db.Where("user_id = ? AND status = ? AND sent_at > ?", *order.UserID, models.CartRecoverySent,
+		time.Now().Add(-cartRecoveryAttribution)).
+		Order("sent_at desc").Limit(1).Find(&recovery)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	return db.Model(&recovery).Updates(map[string]interface{}{
+		"status":       models.CartRecoveryConverted,
+		"converted_at": time.Now(),
+		"order_id":     order.ID,
+	}).Error
+}
+
+// CartRecoveryStats summarizes abandoned cart emails for the dashboard
+type CartRecoveryStats struct {
+	Sent             int64   `json:"sent"`
+	Opened           int64   `json:"opened"`
+	Clicked          int64   `json:"clicked"`
+	Converted        int64   `json:"converted"`
+	RecoveryRate     float64 `json:"recovery_rate"` // converted / sent
+	RecoveredRevenue float64 `json:"recovered_revenue"`
+}
+
+// GetCartRecoveryStats counts recovery emails and what came of them
+func GetCartRecoveryStats(db *gorm.DB) (CartRecoveryStats, error) {
+	var stats CartRecoveryStats
+	delivered := []models.CartRecoveryStatus{models.CartRecoverySent, models.CartRecoveryConverted}
+
+	if err := db.Model(&models.CartRecovery{}).
+		Select(`COUNT(*) AS sent, COUNT(opened_at) AS opened, COUNT(clicked_at) AS clicked,
+			COUNT(*) FILTER (WHERE status = ?) AS converted`, models.CartRecoveryConverted).
+		Where("status IN ?", delivered).
+		Scan(&stats).Error; err != nil {
+		return stats, err
+	}
+
+	if err := db.Model(&models.CartRecovery{}).
+		Joins("JOIN orders ON orders.id = cart_recoveries.order_id").
+		Where("cart_recoveries.status = ? AND orders.status IN ?", models.CartRecoveryConverted,
+			[]models.OrderStatus{models.OrderStatusPaid, models.OrderStatusProcessing, models.OrderStatusShipped, models.OrderStatusDelivered}).
+		Select("COALESCE(SUM(orders.total), 0)").Scan(&stats.RecoveredRevenue).Error; err != nil {
+		return stats, err
+	}
+
+	if stats.Sent > 0 {
+		stats.RecoveryRate = float64(stats.Converted) / float64(stats.Sent)
+	}
+	return stats, nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CheckoutLine is an order item together with the product data pricing rules need
+type CheckoutLine struct {
+	Item       models.OrderItem
+	CategoryID uuid.UUID
+	Weight     int // grams per unit
+}
+
+// Checkout is everything needed to place an order
+type Checkout struct {
+	Order       *models.Order // customer, address and notes filled in by the caller
+	Lines       []CheckoutLine
+	CouponCode  string
+	Courier     string // cheapest active courier when empty
+	Destination ShippingDestination
+	Customer    CouponCustomer
+	Actor       Actor
+}
+
+// PlaceOrder prices the order, applies the coupon, creates the order and its
+// items, reserves stock, publishes EventOrderPlaced and queues the confirmation
+// email, all inside tx. Any error leaves tx to be rolled back.
+func PlaceOrder(tx *gorm.DB, checkout Checkout) error {
+	order := checkout.Order
+
+	var subtotal float64
+	var weight int
+	items := make([]models.OrderItem, len(checkout.Lines))
+	couponLines := make([]CouponLine, len(checkout.Lines))
+	for i, line := range checkout.Lines {
+		items[i] = line.Item
+		subtotal += line.Item.Subtotal
+		weight += line.Weight * line.Item.Quantity
+		couponLines[i] = CouponLine{ProductID: line.Item.ProductID, CategoryID: line.CategoryID, Subtotal: line.Item.Subtotal}
+	}
+
+	order.Status = models.OrderStatusPending
+	order.Subtotal = subtotal
+
+	quotes, err := QuoteShipping(tx, checkout.Destination, weight, checkout.Courier, subtotal)
+	if err != nil {
+		return err
+	}
+	order.Courier = quotes[0].Courier
+	order.ShippingWeight = weight
+	order.ShippingFee = quotes[0].Fee
+
+	var coupon *models.Coupon
+	if checkout.CouponCode != "" {
+		if coupon, err = LockCoupon(tx, checkout.CouponCode); err != nil {
+			return err
+		}
+		if order.Discount, err = CouponDiscount(tx, coupon, checkout.Customer, couponLines, subtotal, order.ShippingFee); err != nil {
+			return err
+		}
+		order.CouponCode = coupon.Code
+	}
+	order.Total = order.Subtotal + order.ShippingFee - order.Discount
+
+	// Lock the stock rows so the reservation below sees committed values only
+	if err := LockStock(tx, items); err != nil {
+		return err
+	}
+
+	if err := tx.Create(order).Error; err != nil {
+		return err
+	}
+
+	if err := RecordInitialStatus(tx, order, checkout.Actor); err != nil {
+		return err
+	}
+
+	// Create order items and reserve stock
+	for i := range items {
+		items[i].OrderID = order.ID
+		if err := tx.Create(&items[i]).Error; err != nil {
+			return err
+		}
+		if err := ReserveStock(tx, items[i], checkout.Actor); err != nil {
+			return err
+		}
+	}
+	order.Items = items
+
+	if coupon != nil {
+		if err := RedeemCoupon(tx, coupon, order, checkout.Customer); err != nil {
+			return err
+		}
+	}
+	if err := PublishEvent(tx, EventOrderPlaced, order.ID, NewOrderEvent(order, "", checkout.Actor, "")); err != nil {
+		return err
+	}
+	return EnqueueOrderEmail(tx, EmailOrderPlaced, order, "", nil)
+}
+
+// CancelOrder cancels an order and releases everything it was holding: stock
+// goes back with the given ledger reason and any coupon use is returned.
+// The order must have its Items loaded.
+func CancelOrder(tx *gorm.DB, order *models.Order, actor Actor, reason string, stockReason models.StockMovementReason) error {
+	if err := TransitionOrder(tx, order, models.OrderStatusCancelled, actor, reason); err != nil {
+		return err
+	}
+	if err := RestoreOrderStock(tx, order.Items, stockReason, actor); err != nil {
+		return err
+	}
+	return ReleaseCoupon(tx, order)
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB opens TEST_DATABASE_URL (a postgres:// URL) in a fresh schema that
+// is dropped when the test ends. Tests that need it are skipped without it.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	// Every pooled connection works in the test schema
+	parsed, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL must be a postgres:// URL: %v", err)
+	}
+	query := parsed.Query()
+	query.Set("search_path", schema)
+	parsed.RawQuery = query.Encode()
+
+	db, err := gorm.Open(postgres.Open(parsed.String()), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect to test schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := db.AutoMigrate(
+		&models.Product{},
+		&models.ProductVariant{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.OrderStatusHistory{},
+		&models.StockMovement{},
+		&models.DomainEvent{},
+		&models.OutboundEmail{},
+		&models.ShippingZone{},
+		&models.ShippingZoneRegion{},
+		&models.ShippingRate{},
+		&models.ShippingCourier{},
+	); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// TestPlaceOrderLastUnit races checkouts for a product with one unit left:
+// exactly one order is placed and every other checkout runs out of stock,
+// which the API answers with 409
+func TestPlaceOrderLastUnit(t *testing.T) {
+	db := testDB(t)
+
+	zone := models.ShippingZone{Name: "Everywhere", IsDefault: true, IsActive: true,
+		Rates: []models.ShippingRate{{Fee: 10000}}}
+	courier := models.ShippingCourier{Code: "test", Name: "Test Courier", Multiplier: 1, IsActive: true}
+	product := models.Product{Name: "Last Unit", Slug: "last-unit", BasePrice: 50000, Weight: 500, IsActive: true}
+	for _, record := range []interface{}{&zone, &courier, &product} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("create %T: %v", record, err)
+		}
+	}
+	if err := ApplyStockChange(db, StockChange{
+		ProductID: product.ID,
+		Delta:     1,
+		Reason:    models.StockReasonRestock,
+		Actor:     SystemActor,
+	}); err != nil {
+		t.Fatalf("stock product: %v", err)
+	}
+
+	const checkouts = 10
+	errs := make([]error, checkouts)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < checkouts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = db.Transaction(func(tx *gorm.DB) error {
+				return PlaceOrder(tx, Checkout{
+					Order: &models.Order{
+						OrderNumber: fmt.Sprintf("TEST-%d", i),
+						GuestEmail:  fmt.Sprintf("guest%d@example.com", i),
+						GuestName:   "Guest",
+					},
+					Lines: []CheckoutLine{{
+						Item: models.OrderItem{
+							ProductID:   product.ID,
+							ProductName: product.Name,
+							Price:       product.BasePrice,
+							Quantity:    1,
+							Subtotal:    product.BasePrice,
+						},
+						Weight: product.Weight,
+					}},
+					Courier: courier.Code,
+					Actor:   Actor{Role: ActorGuest},
+				})
+			})
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	placed := 0
+	for i, err := range errs {
+		var stockErr *InsufficientStockError
+		switch {
+		case err == nil:
+			placed++
+		case errors.As(err, &stockErr):
+		default:
+			t.Errorf("checkout %d: unexpected error %v", i, err)
+		}
+	}
+	if placed != 1 {
+		t.Fatalf("placed %d orders for the last unit, want exactly 1", placed)
+	}
+
+	var stock int
+	db.Model(&models.Product{}).Where("id = ?", product.ID).Select("stock").Scan(&stock)
+	if stock != 0 {
+		t.Errorf("stock after checkout = %d, want 0", stock)
+	}
+	var orders int64
+	db.Model(&models.Order{}).Count(&orders)
+	if orders != 1 {
+		t.Errorf("%d orders stored, want 1", orders)
+	}
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrCouponNotFound is returned for a code that matches no coupon
+	ErrCouponNotFound = errors.New("coupon not found")
+	// ErrCouponInactive is returned for a coupon an admin switched off
+	ErrCouponInactive = errors.New("coupon is not active")
+	// ErrCouponNotStarted is returned before a coupon's start date
+	ErrCouponNotStarted = errors.New("coupon is not valid yet")
+	// ErrCouponExpired is returned after a coupon's end date
+	ErrCouponExpired = errors.New("coupon has expired")
+	// ErrCouponMinSpend is returned when the order subtotal is below the coupon minimum
+	ErrCouponMinSpend = errors.New("order does not reach the coupon minimum spend")
+	// ErrCouponNotApplicable is returned when no order line is in the coupon's scope
+	ErrCouponNotApplicable = errors.New("coupon does not apply to any item in the order")
+	// ErrCouponUsageLimit is returned once a coupon was used as often as it may be in total
+	ErrCouponUsageLimit = errors.New("coupon usage limit reached")
+	// ErrCouponUserLimit is returned once a customer used a coupon as often as they may
+	ErrCouponUserLimit = errors.New("coupon already used the maximum number of times")
+)
+
+// CouponLine is an order line as seen by coupon scoping rules
+type CouponLine struct {
+	ProductID  uuid.UUID
+	CategoryID uuid.UUID
+	Subtotal   float64
+}
+
+// CouponCustomer identifies who is redeeming a coupon, for per-user limits
+type CouponCustomer struct {
+	UserID     *uuid.UUID
+	GuestEmail string
+}
+
+// NormalizeCouponCode returns the canonical (upper case, trimmed) form of a code
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// LockCoupon loads a coupon by code and locks its row until the transaction
+// ends, so usage limits are checked and counted atomically
+func LockCoupon(tx *gorm.DB, code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ?", NormalizeCouponCode(code)).First(&coupon).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// CouponDiscount validates a coupon against an order and returns the discount
+// it gives. Percentage and fixed discounts only count in-scope lines; free
+// shipping discounts the shipping fee.
+func CouponDiscount(tx *gorm.DB, coupon *models.Coupon, customer CouponCustomer, lines []CouponLine, subtotal, shippingFee float64) (float64, error) {
+	now := time.Now()
+	switch {
+	case !coupon.IsActive:
+		return 0, ErrCouponInactive
+	case coupon.StartsAt != nil && now.Before(*coupon.StartsAt):
+		return 0, ErrCouponNotStarted
+	case coupon.EndsAt != nil && now.After(*coupon.EndsAt):
+		return 0, ErrCouponExpired
+	case subtotal < coupon.MinSpend:
+		return 0, fmt.Errorf("%w of %.0f", ErrCouponMinSpend, coupon.MinSpend)
+	case coupon.UsageLimit > 0 && coupon.UsageCount >= coupon.UsageLimit:
+		return 0, ErrCouponUsageLimit
+	}
+
+	if coupon.PerUserLimit > 0 {
+		used, err := countCouponRedemptions(tx, coupon.ID, customer)
+		if err != nil {
+			return 0, err
+		}
+		if used >= int64(coupon.PerUserLimit) {
+			return 0, ErrCouponUserLimit
+		}
+	}
+
+	eligible, err := eligibleSubtotal(tx, coupon, lines)
+	if err != nil {
+		return 0, err
+	}
+	if eligible == 0 {
+		return 0, ErrCouponNotApplicable
+	}
+
+	var discount float64
+	switch coupon.Type {
+	case models.CouponTypePercentage:
+		discount = math.Round(eligible * coupon.Value / 100)
+		if coupon.MaxDiscount > 0 && discount > coupon.MaxDiscount {
+			discount = coupon.MaxDiscount
+		}
+	case models.CouponTypeFixed:
+		discount = math.Min(coupon.Value, eligible)
+	case models.CouponTypeFreeShipping:
+		discount = shippingFee
+	}
+	return discount, nil
+}
+
+// RedeemCoupon counts a coupon use for an order. The usage counter only moves
+// while it is below the limit, so concurrent checkouts cannot exceed it.
+func RedeemCoupon(tx *gorm.DB, coupon *models.Coupon, order *models.Order, customer CouponCustomer) error {
+	result := tx.Model(&models.Coupon{}).
+		Where("id = ? AND (usage_limit = 0 OR usage_count < usage_limit)", coupon.ID).
+		Update("usage_count", gorm.Expr("usage_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCouponUsageLimit
+	}
+
+	return tx.Create(&models.CouponRedemption{
+		CouponID:   coupon.ID,
+		OrderID:    order.ID,
+		UserID:     customer.UserID,
+		GuestEmail: strings.ToLower(customer.GuestEmail),
+		Discount:   order.Discount,
+	}).Error
+}
+
+// ReleaseCoupon gives back the coupon use held by a cancelled order
+func ReleaseCoupon(tx *gorm.DB, order *models.Order) error {
+	var redemption models.CouponRedemption
+	result := tx.Where("order_id = ?", order.ID).Limit(1).Find(&redemption)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	if err := tx.Delete(&redemption).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Coupon{}).
+		Where("id = ? AND usage_count > 0", redemption.CouponID).
+		Update("usage_count", gorm.Expr("usage_count - 1")).Error
+}
+
+func countCouponRedemptions(tx *gorm.DB, couponID uuid.UUID, customer CouponCustomer) (int64, error) {
+	var count int64
+	query := tx.Model(&models.CouponRedemption{}).Where("coupon_id = ?", couponID)
+	if customer.UserID != nil {
+		query = query.Where("user_id = ?", *customer.UserID)
+	} else {
+		query = query.Where("guest_email = ?", strings.ToLower(customer.GuestEmail))
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// eligibleSubtotal sums the lines that fall inside the coupon's product/category scope
+func eligibleSubtotal(tx *gorm.DB, coupon *models.Coupon, lines []CouponLine) (float64, error) {
+	var productIDs, categoryIDs []uuid.UUID
+	if err := tx.Table("coupon_products").Where("coupon_id = ?", coupon.ID).
+		Pluck("product_id", &productIDs).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Table("coupon_categories").Where("coupon_id = ?", coupon.ID).
+		Pluck("category_id", &categoryIDs).Error; err != nil {
+		return 0, err
+	}
+
+	scoped := len(productIDs) > 0 || len(categoryIDs) > 0
+	products := make(map[uuid.UUID]bool, len(productIDs))
+	for _, id := range productIDs {
+		products[id] = true
+	}
+	categories := make(map[uuid.UUID]bool, len(categoryIDs))
+	for _, id := range categoryIDs {
+		categories[id] = true
+	}
+
+	var eligible float64
+	for _, line := range lines {
+		if !scoped || products[line.ProductID] || categories[line.CategoryID] {
+			eligible += line.Subtotal
+		}
+	}
+	return eligible, nil
+}
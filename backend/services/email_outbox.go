@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Outbox retry policy: the wait doubles after every failed attempt, up to
+// emailMaxBackoff, and an email is given up on after emailMaxAttempts
+const (
+	emailMaxAttempts = 8
+	emailBaseBackoff = time.Minute
+	emailMaxBackoff  = 6 * time.Hour
+	// emailSendLease keeps other workers off an email while it is being sent
+	emailSendLease = 5 * time.Minute
+)
+
+// SendPendingEmails sends up to limit queued emails that are due. Each email is
+// claimed by pushing its next attempt past the send lease first, so concurrent
+// workers never send the same email twice. It returns how many were sent.
+func SendPendingEmails(ctx context.Context, db *gorm.DB, mailer Mailer, limit int) (int, error) {
+	var emails []models.OutboundEmail
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.EmailStatusPending, now).
+			Order("next_attempt_at").Limit(limit).Find(&emails).Error; err != nil {
+			return err
+		}
+		if len(emails) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(emails))
+		for i := range emails {
+			ids[i] = emails[i].ID
+		}
+		return tx.Model(&models.OutboundEmail{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"next_attempt_at": now.Add(emailSendLease),
+			"attempts":        gorm.Expr("attempts + 1"),
+		}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range emails {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		email := &emails[i]
+		email.Attempts++
+
+		sendErr := mailer.Send(ctx, Email{To: email.To, Subject: email.Subject, Text: email.Text, HTML: email.HTML})
+		if err := finishEmail(db, email, sendErr); err != nil {
+			return sent, err
+		}
+		if sendErr == nil {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// finishEmail stores the result of a send attempt, scheduling a retry or giving
+// up after the last attempt
+func finishEmail(db *gorm.DB, email *models.OutboundEmail, sendErr error) error {
+	now := time.Now()
+	updates := map[string]interface{}{}
+	switch {
+	case sendErr == nil:
+		email.Status = models.EmailStatusSent
+		email.SentAt = &now
+		email.LastError = ""
+		updates["sent_at"] = now
+	case email.Attempts >= emailMaxAttempts:
+		email.Status = models.EmailStatusFailed
+		email.LastError = sendErr.Error()
+		log.Printf("Giving up on %s email %s to %s after %d attempts: %v", email.Kind, email.ID, email.To, email.Attempts, sendErr)
+	default:
+		email.LastError = sendErr.Error()
+		email.NextAttemptAt = now.Add(Backoff(email.Attempts, emailBaseBackoff, emailMaxBackoff))
+		updates["next_attempt_at"] = email.NextAttemptAt
+	}
+	updates["status"] = email.Status
+	updates["last_error"] = email.LastError
+
+	return db.Model(&models.OutboundEmail{}).Where("id = ?", email.ID).Updates(updates).Error
+}
+
+// RetryEmail queues a failed or pending email to be sent on the next run
+func RetryEmail(db *gorm.DB, email *models.OutboundEmail) error {
+	email.Status = models.EmailStatusPending
+	email.Attempts = 0
+	email.NextAttemptAt = time.Now()
+	return db.Model(&models.OutboundEmail{}).Where("id = ?", email.ID).Updates(map[string]interface{}{
+		"status":          email.Status,
+		"attempts":        0,
+		"next_attempt_at": email.NextAttemptAt,
+	}).Error
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Domain event types
+const (
+	EventOrderPlaced        = "order.placed"
+	EventOrderPaid          = "order.paid"
+	EventOrderShipped       = "order.shipped"
+	EventOrderCancelled     = "order.cancelled"
+	EventOrderStatusChanged = "order.status_changed"
+	EventProductCreated     = "product.created"
+	EventProductUpdated     = "product.updated"
+	EventStockChanged       = "stock.changed"
+	EventStockLow           = "stock.low"
+	EventUserRegistered     = "user.registered"
+)
+
+// Dispatcher retry policy, like the email outbox
+const (
+	eventMaxAttempts   = 10
+	eventBaseBackoff   = 30 * time.Second
+	eventMaxBackoff    = time.Hour
+	eventDispatchLease = 5 * time.Minute
+)
+
+// OrderEvent is the payload of the order events
+type OrderEvent struct {
+	OrderID        uuid.UUID          `json:"order_id"`
+	OrderNumber    string             `json:"order_number"`
+	UserID         *uuid.UUID         `json:"user_id,omitempty"`
+	Status         models.OrderStatus `json:"status"`
+	PreviousStatus models.OrderStatus `json:"previous_status,omitempty"`
+	Total          float64            `json:"total"`
+	Courier        string             `json:"courier,omitempty"`
+	TrackingNumber string             `json:"tracking_number,omitempty"`
+	Reason         string             `json:"reason,omitempty"`
+	ActorRole      string             `json:"actor_role,omitempty"`
+}
+
+// ProductEvent is the payload of the product events
+type ProductEvent struct {
+	ProductID  uuid.UUID `json:"product_id"`
+	Name       string    `json:"name"`
+	Slug       string    `json:"slug"`
+	BasePrice  float64   `json:"base_price"`
+	CategoryID uuid.UUID `json:"category_id"`
+	Weight     int       `json:"weight"`
+	IsActive   bool      `json:"is_active"`
+	IsFeatured bool      `json:"is_featured"`
+}
+
+// StockChangedEvent is the payload of EventStockChanged, published for every
+// stock movement
+type StockChangedEvent struct {
+	ProductID   uuid.UUID                  `json:"product_id"`
+	VariantID   *uuid.UUID                 `json:"variant_id,omitempty"`
+	Delta       int                        `json:"delta"`
+	Stock       int                        `json:"stock"` // of the variant when there is one
+	Reason      models.StockMovementReason `json:"reason"`
+	ReferenceID *uuid.UUID                 `json:"reference_id,omitempty"`
+}
+
+// StockLowEvent is the payload of EventStockLow, published when stock drops
+// below the low stock threshold
+type StockLowEvent struct {
+	ProductID uuid.UUID  `json:"product_id"`
+	VariantID *uuid.UUID `json:"variant_id,omitempty"`
+	Stock     int        `json:"stock"`
+	Threshold int        `json:"threshold"`
+}
+
+// UserRegisteredEvent is the payload of EventUserRegistered
+type UserRegisteredEvent struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Email    string    `json:"email"`
+	Name     string    `json:"name"`
+	Provider string    `json:"provider"` // "password" or "google"
+}
+
+// NewOrderEvent describes an order for the order events
+func NewOrderEvent(order *models.Order, previous models.OrderStatus, actor Actor, reason string) OrderEvent {
+	return OrderEvent{
+		OrderID:        order.ID,
+		OrderNumber:    order.OrderNumber,
+		UserID:         order.UserID,
+		Status:         order.Status,
+		PreviousStatus: previous,
+		Total:          order.Total,
+		Courier:        order.Courier,
+		TrackingNumber: order.TrackingNumber,
+		Reason:         reason,
+		ActorRole:      actor.Role,
+	}
+}
+
+// NewProductEvent describes a product for the product events
+func NewProductEvent(product *models.Product) ProductEvent {
+	return ProductEvent{
+		ProductID:  product.ID,
+		Name:       product.Name,
+		Slug:       product.Slug,
+		BasePrice:  product.BasePrice,
+		CategoryID: product.CategoryID,
+		Weight:     product.Weight,
+		IsActive:   product.IsActive,
+		IsFeatured: product.IsFeatured,
+	}
+}
+
+// PublishEvent writes a domain event to the outbox inside tx, so subscribers
+// only hear about changes that were committed
+func PublishEvent(tx *gorm.DB, eventType string, aggregateID uuid.UUID, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.DomainEvent{
+		Type:          eventType,
+		AggregateID:   aggregateID,
+		Payload:       string(data),
+		Status:        models.EventStatusPending,
+		NextAttemptAt: tx.NowFunc(),
+		Delivered:     []string{},
+	}).Error
+}
+
+// Event is a domain event as subscribers receive it
+type Event struct {
+	ID          uuid.UUID
+	Type        string
+	AggregateID uuid.UUID
+	Payload     json.RawMessage
+	CreatedAt   time.Time
+}
+
+// Decode unmarshals the event payload into v
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// EventHandler handles one event. Delivery is at least once: a handler may see
+// an event again after a crash or a failure of another step, so it should be
+// safe to repeat.
+type EventHandler func(ctx context.Context, db *gorm.DB, event Event) error
+
+type eventSubscriber struct {
+	name    string
+	handler EventHandler
+}
+
+// EventBus routes domain events to the in-process subscribers registered for them
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[string][]eventSubscriber
+}
+
+// NewEventBus returns an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: map[string][]eventSubscriber{}}
+}
+
+// Subscribe registers handler for an event type. The name identifies the
+// subscriber in the outbox, so each subscriber is retried on its own and
+// never sees an event again once it handled it.
+func (b *EventBus) Subscribe(eventType, name string, handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[eventType] = append(b.subscribers[eventType], eventSubscriber{name: name, handler: handler})
+}
+
+// subscribersFor returns the subscribers of an event type
+func (b *EventBus) subscribersFor(eventType string) []eventSubscriber {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]eventSubscriber(nil), b.subscribers[eventType]...)
+}
+
+// DispatchEvents delivers up to limit due events to their subscribers. Events
+// are claimed like queued emails, so concurrent dispatchers never deliver the
+// same event at once. Subscribers that fail are retried with backoff; the
+// ones that succeeded are remembered and not called again. It returns how
+// many events were fully delivered.
+func DispatchEvents(ctx context.Context, db *gorm.DB, bus *EventBus, limit int) (int, error) {
+	var events []models.DomainEvent
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.EventStatusPending, now).
+			Order("created_at").Limit(limit).Find(&events).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(events))
+		for i := range events {
+			ids[i] = events[i].ID
+		}
+		return tx.Model(&models.DomainEvent{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"next_attempt_at": now.Add(eventDispatchLease),
+			"attempts":        gorm.Expr("attempts + 1"),
+		}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for i := range events {
+		if ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+		event := &events[i]
+		event.Attempts++
+
+		failures := deliverEvent(ctx, db, bus, event)
+		if err := finishEvent(db, event, failures); err != nil {
+			return delivered, err
+		}
+		if event.Status == models.EventStatusDelivered {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// deliverEvent calls every subscriber that has not handled the event yet,
+// adding the ones that succeed to event.Delivered. It returns the failures.
+func deliverEvent(ctx context.Context, db *gorm.DB, bus *EventBus, event *models.DomainEvent) []string {
+	done := make(map[string]bool, len(event.Delivered))
+	for _, name := range event.Delivered {
+		done[name] = true
+	}
+
+	payload := Event{
+		ID:          event.ID,
+		Type:        event.Type,
+		AggregateID: event.AggregateID,
+		Payload:     json.RawMessage(event.Payload),
+		CreatedAt:   event.CreatedAt,
+	}
+
+	var failures []string
+	for _, subscriber := range bus.subscribersFor(event.Type) {
+		if done[subscriber.name] {
+			continue
+		}
+		if err := callSubscriber(ctx, db, subscriber, payload); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", subscriber.name, err))
+			continue
+		}
+		event.Delivered = append(event.Delivered, subscriber.name)
+		done[subscriber.name] = true
+	}
+	return failures
+}
+
+// callSubscriber runs one subscriber, turning a panic into an error so it
+// cannot take the dispatcher down
+func callSubscriber(ctx context.Context, db *gorm.DB, subscriber eventSubscriber, event Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return subscriber.handler(ctx, db, event)
+}
+
+// finishEvent stores the result of a delivery attempt, scheduling a retry for
+// the failed subscribers or giving up after the last attempt
+func finishEvent(db *gorm.DB, event *models.DomainEvent, failures []string) error {
+	now := time.Now()
+	event.LastError = strings.Join(failures, "; ")
+
+	updates := map[string]interface{}{}
+	switch {
+	case len(failures) == 0:
+		event.Status = models.EventStatusDelivered
+		event.DeliveredAt = &now
+		updates["delivered_at"] = now
+	case event.Attempts >= eventMaxAttempts:
+		event.Status = models.EventStatusFailed
+		log.Printf("Giving up on %s event %s after %d attempts: %s", event.Type, event.ID, event.Attempts, event.LastError)
+	default:
+		event.NextAttemptAt = now.Add(Backoff(event.Attempts, eventBaseBackoff, eventMaxBackoff))
+		updates["next_attempt_at"] = event.NextAttemptAt
+	}
+	updates["status"] = event.Status
+	updates["last_error"] = event.LastError
+
+	// Map updates skip the column serializer, so store the JSON it would
+	delivered, err := json.Marshal(event.Delivered)
+	if err != nil {
+		return err
+	}
+	updates["delivered"] = string(delivered)
+
+	return db.Model(&models.DomainEvent{}).Where("id = ?", event.ID).Updates(updates).Error
+}
+
+// RetryEvent queues a failed event for its remaining subscribers on the next run
+func RetryEvent(db *gorm.DB, event *models.DomainEvent) error {
+	event.Status = models.EventStatusPending
+	event.Attempts = 0
+	event.NextAttemptAt = time.Now()
+	return db.Model(&models.DomainEvent{}).Where("id = ?", event.ID).Updates(map[string]interface{}{
+		"status":          event.Status,
+		"attempts":        0,
+		"next_attempt_at": event.NextAttemptAt,
+	}).Error
+}
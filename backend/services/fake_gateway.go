@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// fakeServerKey signs notifications produced by the fake gateway
+const fakeServerKey = "fake-server-key"
+
+type fakeTransaction struct {
+	txn       GatewayTransaction
+	amount    float64
+	refunded  float64
+	refunds   map[string]RefundResult // by refund key, so a retried refund pays once
+	finishURL string
+}
+
+// FakeGateway is an in-process payment provider for development and tests.
+// Customers are sent to a local pay page instead of Midtrans Snap; visiting it
+// settles the transaction and produces a signed notification.
+type FakeGateway struct {
+	BaseURL string
+
+	mu           sync.Mutex
+	transactions map[string]*fakeTransaction
+}
+
+// NewFakeGateway returns a fake gateway whose pay pages are served under baseURL
+func NewFakeGateway(baseURL string) *FakeGateway {
+	return &FakeGateway{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		transactions: make(map[string]*fakeTransaction),
+	}
+}
+
+func (f *FakeGateway) Name() string {
+	return ProviderFake
+}
+
+// CreateCharge records a pending transaction
+func (f *FakeGateway) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.transactions[req.Reference] = &fakeTransaction{
+		txn: GatewayTransaction{
+			Reference:         req.Reference,
+			TransactionID:     uuid.New().String(),
+			TransactionStatus: TransactionPending,
+			StatusCode:        "201",
+			GrossAmount:       fmt.Sprintf("%.2f", req.Amount),
+		},
+		amount:    req.Amount,
+		refunds:   make(map[string]RefundResult),
+		finishURL: req.FinishURL,
+	}
+
+	return &Charge{
+		Token:       "fake-" + uuid.New().String(),
+		RedirectURL: f.BaseURL + "/api/payments/fake/" + req.Reference + "/pay",
+	}, nil
+}
+
+// VerifyNotification parses a notification signed with the fake server key
+func (f *FakeGateway) VerifyNotification(body []byte) (*GatewayTransaction, error) {
+	return parseSignedNotification(body, fakeServerKey)
+}
+
+// QueryStatus returns the recorded state of a transaction
+func (f *FakeGateway) QueryStatus(ctx context.Context, reference string) (*GatewayTransaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.transactions[reference]
+	if !ok {
+		return nil, ErrTransactionNotFound
+	}
+	txn := t.txn
+	return &txn, nil
+}
+
+// Refund records a full or partial refund of a settled transaction
+func (f *FakeGateway) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.transactions[req.Reference]
+	if !ok {
+		return nil, fmt.Errorf("fake: %w: %v", ErrRefundRejected, ErrTransactionNotFound)
+	}
+	if result, ok := t.refunds[req.RefundKey]; ok {
+		return &result, nil
+	}
+	if t.txn.TransactionStatus != TransactionSettlement && t.txn.TransactionStatus != TransactionCapture &&
+		t.txn.TransactionStatus != TransactionPartialRefund {
+		return nil, fmt.Errorf("fake: %w: transaction %s is %s", ErrRefundRejected, req.Reference, t.txn.TransactionStatus)
+	}
+	if t.refunded+req.Amount > t.amount {
+		return nil, fmt.Errorf("fake: %w: refund exceeds settled amount", ErrRefundRejected)
+	}
+
+	t.refunded += req.Amount
+	t.txn.TransactionStatus = TransactionPartialRefund
+	if t.refunded == t.amount {
+		t.txn.TransactionStatus = TransactionRefund
+	}
+
+	result := RefundResult{ID: uuid.New().String(), RefundKey: req.RefundKey, TransactionStatus: t.txn.TransactionStatus}
+	t.refunds[req.RefundKey] = result
+	return &result, nil
+}
+
+// Complete moves a transaction to the given status, as if the customer had
+// finished (or abandoned) payment, and returns the signed notification body
+// together with the URL the customer should be sent back to.
+func (f *FakeGateway) Complete(reference, status string) ([]byte, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.transactions[reference]
+	if !ok {
+		return nil, "", ErrTransactionNotFound
+	}
+
+	switch status {
+	case TransactionSettlement, TransactionCapture:
+		t.txn.StatusCode = "200"
+		t.txn.PaymentType = "fake"
+	case TransactionDeny, TransactionCancel, TransactionExpire:
+		t.txn.StatusCode = "202"
+	default:
+		return nil, "", fmt.Errorf("fake: unsupported status %q", status)
+	}
+	t.txn.TransactionStatus = status
+
+	notification := t.txn
+	notification.SignatureKey = notificationSignature(&notification, fakeServerKey)
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, t.finishURL, nil
+}
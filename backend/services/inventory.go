@@ -0,0 +1,373 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrVariantStockRequired is returned when stock is set on a product that has
+// variants; its stock is the sum of theirs, so each variant is set instead
+var ErrVariantStockRequired = errors.New("product has variants; set the stock of each variant")
+
+// InsufficientStockError names the exact product or variant that ran out
+type InsufficientStockError struct {
+	ProductID   uuid.UUID
+	VariantID   *uuid.UUID
+	ProductName string
+	VariantInfo string
+	Requested   int
+}
+
+func (e *InsufficientStockError) Error() string {
+	if e.ProductName == "" {
+		return "Insufficient stock"
+	}
+	if e.VariantID != nil {
+		return fmt.Sprintf("Insufficient stock for %s (%s)", e.ProductName, e.VariantInfo)
+	}
+	return fmt.Sprintf("Insufficient stock for %s", e.ProductName)
+}
+
+// LockStock takes row locks (SELECT ... FOR UPDATE) on every product and variant
+// touched by the items. Rows are locked in primary key order so concurrent
+// checkouts over overlapping products cannot deadlock.
+func LockStock(tx *gorm.DB, items []models.OrderItem) error {
+	var productIDs, variantIDs []string
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID.String())
+		if item.VariantID != nil {
+			variantIDs = append(variantIDs, item.VariantID.String())
+		}
+	}
+	sort.Strings(productIDs)
+	sort.Strings(variantIDs)
+
+	var products []models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").Where("id IN ?", productIDs).Order("id").
+		Find(&products).Error; err != nil {
+		return err
+	}
+
+	if len(variantIDs) > 0 {
+		var variants []models.ProductVariant
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").Where("id IN ?", variantIDs).Order("id").
+			Find(&variants).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StockChange describes a single change to product or variant stock
+type StockChange struct {
+	ProductID   uuid.UUID
+	VariantID   *uuid.UUID
+	Delta       int
+	Reason      models.StockMovementReason
+	ReferenceID *uuid.UUID
+	Actor       Actor
+	Note        string
+}
+
+// ApplyStockChange is the single place where stock is changed. It updates the
+// variant (if any) and product rows and appends the matching StockMovement in the
+// same transaction. Decrements only apply while enough stock is left; otherwise
+// an *InsufficientStockError is returned and nothing is written. Every change
+// publishes EventStockChanged, and EventStockLow when stock runs low.
+func ApplyStockChange(tx *gorm.DB, change StockChange) error {
+	if change.Delta == 0 {
+		return nil
+	}
+
+	if change.VariantID != nil {
+		if err := applyStockDelta(tx, &models.ProductVariant{}, change.Delta, "id = ? AND product_id = ?", *change.VariantID, change.ProductID); err != nil {
+			if stockErr, ok := err.(*InsufficientStockError); ok {
+				stockErr.ProductID = change.ProductID
+				stockErr.VariantID = change.VariantID
+			}
+			return err
+		}
+	}
+
+	if err := applyStockDelta(tx, &models.Product{}, change.Delta, "id = ?", change.ProductID); err != nil {
+		if stockErr, ok := err.(*InsufficientStockError); ok {
+			stockErr.ProductID = change.ProductID
+		}
+		return err
+	}
+
+	if err := tx.Create(&models.StockMovement{
+		ProductID:   change.ProductID,
+		VariantID:   change.VariantID,
+		Delta:       change.Delta,
+		Reason:      change.Reason,
+		ReferenceID: change.ReferenceID,
+		ActorID:     change.Actor.UserID,
+		ActorRole:   change.Actor.Role,
+		Note:        change.Note,
+	}).Error; err != nil {
+		return err
+	}
+
+	return publishStockChange(tx, change)
+}
+
+// lowStockThreshold is the stock level below which EventStockLow is published;
+// 0 turns low stock events off
+var lowStockThreshold int
+
+// InitLowStockAlerts sets the low stock threshold
+func InitLowStockAlerts(threshold int) {
+	lowStockThreshold = threshold
+}
+
+// publishStockChange publishes EventStockChanged with the new stock of the
+// variant (or product without variants), and EventStockLow when a decrement
+// took it below the threshold. Only the change that crosses the threshold
+// publishes EventStockLow, not every sale after.
+func publishStockChange(tx *gorm.DB, change StockChange) error {
+	var stock int
+	query := tx.Unscoped().Select("stock")
+	if change.VariantID != nil {
+		query = query.Model(&models.ProductVariant{}).Where("id = ?", *change.VariantID)
+	} else {
+		query = query.Model(&models.Product{}).Where("id = ?", change.ProductID)
+	}
+	if err := query.Take(&stock).Error; err != nil {
+		return err
+	}
+
+	if err := PublishEvent(tx, EventStockChanged, change.ProductID, StockChangedEvent{
+		ProductID:   change.ProductID,
+		VariantID:   change.VariantID,
+		Delta:       change.Delta,
+		Stock:       stock,
+		Reason:      change.Reason,
+		ReferenceID: change.ReferenceID,
+	}); err != nil {
+		return err
+	}
+
+	if lowStockThreshold <= 0 || stock >= lowStockThreshold || stock-change.Delta < lowStockThreshold {
+		return nil
+	}
+	return PublishEvent(tx, EventStockLow, change.ProductID, StockLowEvent{
+		ProductID: change.ProductID,
+		VariantID: change.VariantID,
+		Stock:     stock,
+		Threshold: lowStockThreshold,
+	})
+}
+
+// applyStockDelta adds delta to the stock column of the row matched by query.
+// Returning stock also applies to soft-deleted rows so cancelled orders of
+// removed products still balance.
+func applyStockDelta(tx *gorm.DB, model interface{}, delta int, query string, args ...interface{}) error {
+	if delta > 0 {
+		return tx.Unscoped().Model(model).Where(query, args...).
+			Update("stock", gorm.Expr("stock + ?", delta)).Error
+	}
+
+	result := tx.Model(model).Where(query, args...).Where("stock >= ?", -delta).
+		Update("stock", gorm.Expr("stock + ?", delta))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &InsufficientStockError{Requested: -delta}
+	}
+	return nil
+}
+
+// ReserveStock takes the item quantity out of stock for its order
+func ReserveStock(tx *gorm.DB, item models.OrderItem, actor Actor) error {
+	err := ApplyStockChange(tx, StockChange{
+		ProductID:   item.ProductID,
+		VariantID:   item.VariantID,
+		Delta:       -item.Quantity,
+		Reason:      models.StockReasonOrderReserved,
+		ReferenceID: &item.OrderID,
+		Actor:       actor,
+	})
+	if stockErr, ok := err.(*InsufficientStockError); ok {
+		stockErr.ProductName = item.ProductName
+		stockErr.VariantInfo = item.VariantInfo
+	}
+	return err
+}
+
+// RestoreOrderStock returns the reserved quantities of the order items to stock
+func RestoreOrderStock(tx *gorm.DB, items []models.OrderItem, reason models.StockMovementReason, actor Actor) error {
+	for _, item := range items {
+		if err := ApplyStockChange(tx, StockChange{
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			Delta:       item.Quantity,
+			Reason:      reason,
+			ReferenceID: &item.OrderID,
+			Actor:       actor,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetStock sets the product (or variant) stock to an absolute value, recording
+// the difference as a movement with the given reason. A product with variants
+// only takes stock through its variants.
+func SetStock(tx *gorm.DB, productID uuid.UUID, variantID *uuid.UUID, stock int, reason models.StockMovementReason, actor Actor, note string) error {
+	if stock < 0 {
+		return &InsufficientStockError{ProductID: productID, VariantID: variantID}
+	}
+
+	if variantID == nil {
+		var variants int64
+		if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", productID).Count(&variants).Error; err != nil {
+			return err
+		}
+		if variants > 0 {
+			return ErrVariantStockRequired
+		}
+	}
+
+	var current int
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("stock")
+	if variantID != nil {
+		query = query.Model(&models.ProductVariant{}).Where("id = ? AND product_id = ?", *variantID, productID)
+	} else {
+		query = query.Model(&models.Product{}).Where("id = ?", productID)
+	}
+	if err := query.Take(&current).Error; err != nil {
+		return err
+	}
+
+	return ApplyStockChange(tx, StockChange{
+		ProductID: productID,
+		VariantID: variantID,
+		Delta:     stock - current,
+		Reason:    reason,
+		Actor:     actor,
+		Note:      note,
+	})
+}
+
+// VariantStock is the rebuilt stock of a single variant
+type VariantStock struct {
+	VariantID     uuid.UUID `json:"variant_id"`
+	PreviousStock int       `json:"previous_stock"`
+	Stock         int       `json:"stock"`
+}
+
+// StockRebuild reports the result of recomputing stock from the ledger
+type StockRebuild struct {
+	ProductID     uuid.UUID      `json:"product_id"`
+	PreviousStock int            `json:"previous_stock"`
+	Stock         int            `json:"stock"`
+	Variants      []VariantStock `json:"variants"`
+}
+
+// RebuildStock recomputes the stock of a product and its variants from the
+// movement ledger and writes the result back
+func RebuildStock(tx *gorm.DB, productID uuid.UUID) (*StockRebuild, error) {
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, "id = ?", productID).Error; err != nil {
+		return nil, err
+	}
+
+	var variants []models.ProductVariant
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id = ?", productID).Order("id").Find(&variants).Error; err != nil {
+		return nil, err
+	}
+
+	rebuild := &StockRebuild{ProductID: productID, PreviousStock: product.Stock}
+	if err := tx.Model(&models.StockMovement{}).Where("product_id = ?", productID).
+		Select("COALESCE(SUM(delta), 0)").Scan(&rebuild.Stock).Error; err != nil {
+		return nil, err
+	}
+
+	var variantTotals []struct {
+		VariantID uuid.UUID
+		Total     int
+	}
+	if err := tx.Model(&models.StockMovement{}).
+		Select("variant_id, SUM(delta) AS total").
+		Where("product_id = ? AND variant_id IS NOT NULL", productID).
+		Group("variant_id").Scan(&variantTotals).Error; err != nil {
+		return nil, err
+	}
+	totals := make(map[uuid.UUID]int, len(variantTotals))
+	for _, t := range variantTotals {
+		totals[t.VariantID] = t.Total
+	}
+
+	if err := tx.Model(&product).Update("stock", rebuild.Stock).Error; err != nil {
+		return nil, err
+	}
+	for _, variant := range variants {
+		stock := totals[variant.ID]
+		if err := tx.Model(&variant).Update("stock", stock).Error; err != nil {
+			return nil, err
+		}
+		rebuild.Variants = append(rebuild.Variants, VariantStock{
+			VariantID:     variant.ID,
+			PreviousStock: variant.Stock,
+			Stock:         stock,
+		})
+	}
+
+	return rebuild, nil
+}
+
+// RecordOpeningBalances writes a first movement for every product that has no
+// ledger entries yet, so stock that predates the ledger can be rebuilt
+func RecordOpeningBalances(db *gorm.DB) error {
+	var products []models.Product
+	if err := db.Preload("Variants").
+		Where("NOT EXISTS (SELECT 1 FROM stock_movements WHERE stock_movements.product_id = products.id)").
+		Find(&products).Error; err != nil {
+		return err
+	}
+
+	for _, product := range products {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			variantTotal := 0
+			for _, variant := range product.Variants {
+				variantID := variant.ID
+				variantTotal += variant.Stock
+				if err := createOpeningBalance(tx, product.ID, &variantID, variant.Stock); err != nil {
+					return err
+				}
+			}
+			return createOpeningBalance(tx, product.ID, nil, product.Stock-variantTotal)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createOpeningBalance(tx *gorm.DB, productID uuid.UUID, variantID *uuid.UUID, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return tx.Create(&models.StockMovement{
+		ProductID: productID,
+		VariantID: variantID,
+		Delta:     delta,
+		Reason:    models.StockReasonAdminAdjustment,
+		ActorRole: ActorSystem,
+		Note:      "Opening balance",
+	}).Error
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nexora-backend/config"
+
+	"github.com/google/uuid"
+)
+
+// Mail drivers selectable through MAIL_DRIVER
+const (
+	MailDriverSMTP = "smtp"
+	MailDriverFile = "file"
+	MailDriverLog  = "log"
+)
+
+// Email is a message with a plain text and an optional HTML body
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer is implemented by every way of sending email
+type Mailer interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// NewMailerFromConfig returns the mailer selected by MAIL_DRIVER
+func NewMailerFromConfig(cfg *config.Config) (Mailer, error) {
+	switch cfg.MailDriver {
+	case MailDriverSMTP:
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("MAIL_DRIVER=smtp needs SMTP_HOST")
+		}
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}, nil
+	case MailDriverFile:
+		return &FileMailer{Dir: cfg.MailOutboxDir, From: cfg.MailFrom}, nil
+	case MailDriverLog:
+		return &FileMailer{From: cfg.MailFrom}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.MailDriver)
+	}
+}
+
+// buildMessage renders an email as a MIME message, multipart/alternative when
+// it has an HTML body
+func buildMessage(from string, email Email) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", email.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@nexora>\r\n", uuid.New().String())
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if email.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+		buf.WriteString(email.Text)
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", email.Text},
+		{"text/html; charset=UTF-8", email.HTML},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+// SMTPMailer sends email through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers an email through the SMTP server
+func (m *SMTPMailer) Send(ctx context.Context, email Email) error {
+	msg, err := buildMessage(m.From, email)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, from.Address, []string{email.To}, msg)
+}
+
+// FileMailer writes every email as an .eml file into Dir, or only logs it when
+// Dir is empty. It is meant for development.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes or logs an email
+func (m *FileMailer) Send(ctx context.Context, email Email) error {
+	if m.Dir == "" {
+		log.Printf("Mail to %s: %s\n%s", email.To, email.Subject, email.Text)
+		return nil
+	}
+
+	msg, err := buildMessage(m.From, email)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(email.To)
+	name := fmt.Sprintf("%s-%s-%s.eml", time.Now().Format("20060102-150405"), recipient, uuid.New().String()[:8])
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, msg, 0o644); err != nil {
+		return err
+	}
+	log.Printf("Mail to %s written to %s", email.To, path)
+	return nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MidtransGateway talks to the Midtrans Snap and Core APIs
+type MidtransGateway struct {
+	ServerKey string
+	SnapURL   string
+	APIURL    string
+	Client    *http.Client
+}
+
+// NewMidtransGateway returns a Midtrans gateway for the sandbox or production environment
+func NewMidtransGateway(serverKey string, isProduction bool) *MidtransGateway {
+	gateway := &MidtransGateway{
+		ServerKey: serverKey,
+		SnapURL:   "https://app.sandbox.midtrans.com/snap/v1/transactions",
+		APIURL:    "https://api.sandbox.midtrans.com",
+		Client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if isProduction {
+		gateway.SnapURL = "https://app.midtrans.com/snap/v1/transactions"
+		gateway.APIURL = "https://api.midtrans.com"
+	}
+	return gateway
+}
+
+func (m *MidtransGateway) Name() string {
+	return ProviderMidtrans
+}
+
+// CreateCharge creates a Snap transaction
+func (m *MidtransGateway) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	customer := map[string]interface{}{
+		"first_name": req.CustomerName,
+		"email":      req.CustomerEmail,
+	}
+	if req.CustomerPhone != "" {
+		customer["phone"] = req.CustomerPhone
+	}
+
+	snapRequest := map[string]interface{}{
+		"transaction_details": map[string]interface{}{
+			"order_id":     req.Reference,
+			"gross_amount": int(req.Amount),
+		},
+		"customer_details": customer,
+		"callbacks": map[string]interface{}{
+			"finish": req.FinishURL,
+		},
+	}
+
+	var snapResp struct {
+		Token       string `json:"token"`
+		RedirectURL string `json:"redirect_url"`
+	}
+	body, err := m.do(ctx, http.MethodPost, m.SnapURL, snapRequest, &snapResp)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapResp.Token == "" {
+		log.Printf("Midtrans Error Body: %s", string(body))
+		return nil, fmt.Errorf("midtrans: no snap token in response")
+	}
+
+	return &Charge{Token: snapResp.Token, RedirectURL: snapResp.RedirectURL}, nil
+}
+
+// VerifyNotification parses an HTTP notification and checks its signature key
+func (m *MidtransGateway) VerifyNotification(body []byte) (*GatewayTransaction, error) {
+	return parseSignedNotification(body, m.ServerKey)
+}
+
+// QueryStatus calls the Core API transaction status endpoint
+func (m *MidtransGateway) QueryStatus(ctx context.Context, reference string) (*GatewayTransaction, error) {
+	var txn GatewayTransaction
+	if _, err := m.do(ctx, http.MethodGet, m.APIURL+"/v2/"+reference+"/status", nil, &txn); err != nil {
+		return nil, err
+	}
+
+	switch txn.StatusCode {
+	case "404":
+		return nil, ErrTransactionNotFound
+	case "200", "201", "202", "407":
+		return &txn, nil
+	default:
+		return nil, fmt.Errorf("midtrans: status query returned %s", txn.StatusCode)
+	}
+}
+
+// Refund calls the Core API refund endpoint
+func (m *MidtransGateway) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	refundRequest := map[string]interface{}{
+		"refund_key": req.RefundKey,
+		"amount":     int(req.Amount),
+		"reason":     req.Reason,
+	}
+
+	var refundResp struct {
+		StatusCode         string      `json:"status_code"`
+		StatusMessage      string      `json:"status_message"`
+		TransactionStatus  string      `json:"transaction_status"`
+		RefundKey          string      `json:"refund_key"`
+		RefundChargebackID json.Number `json:"refund_chargeback_id"`
+	}
+	if _, err := m.do(ctx, http.MethodPost, m.APIURL+"/v2/"+req.Reference+"/refund", refundRequest, &refundResp); err != nil {
+		return nil, err
+	}
+
+	if refundResp.StatusCode != "200" {
+		// Only a 4xx answer says no money moved; anything else may still pay out
+		if strings.HasPrefix(refundResp.StatusCode, "4") {
+			return nil, fmt.Errorf("midtrans: %w: %s %s", ErrRefundRejected, refundResp.StatusCode, refundResp.StatusMessage)
+		}
+		return nil, fmt.Errorf("midtrans: refund failed: %s %s", refundResp.StatusCode, refundResp.StatusMessage)
+	}
+
+	return &RefundResult{
+		ID:                refundResp.RefundChargebackID.String(),
+		RefundKey:         refundResp.RefundKey,
+		TransactionStatus: refundResp.TransactionStatus,
+	}, nil
+}
+
+// do sends an authenticated JSON request and decodes the response into out.
+// The raw response body is returned for logging.
+func (m *MidtransGateway) do(ctx context.Context, method, url string, payload interface{}, out interface{}) ([]byte, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		jsonBody, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewBuffer(jsonBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(m.ServerKey, "")
+
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("midtrans: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("midtrans: %w", err)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		log.Printf("Midtrans Error Body: %s", string(body))
+		return body, fmt.Errorf("midtrans: failed to parse response: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+
+	"nexora-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Order emails, named after their templates in templates/email
+const (
+	EmailOrderPlaced          = "order_placed"
+	EmailPaymentReceived      = "payment_received"
+	EmailOrderShipped         = "order_shipped"
+	EmailOrderDelivered       = "order_delivered"
+	EmailOrderCancelled       = "order_cancelled"
+	EmailOrderRefunded        = "order_refunded"
+	EmailAdminOrderPlaced     = "admin_order_placed"
+	EmailAdminPaymentReceived = "admin_payment_received"
+)
+
+//go:embed templates/email
+var emailTemplateFS embed.FS
+
+var emailTemplateFuncs = map[string]interface{}{
+	"rupiah": func(amount float64) string { return fmt.Sprintf("Rp %.0f", amount) },
+}
+
+// OrderEmailOptions configures the emails sent about orders and by event subscribers
+type OrderEmailOptions struct {
+	FrontendURL string
+	AdminEmail  string // copies of new and paid orders, and low stock alerts, go here when set
+}
+
+var orderEmails OrderEmailOptions
+
+// InitOrderEmails sets where order email links point and who gets admin copies
+func InitOrderEmails(opts OrderEmailOptions) {
+	orderEmails = opts
+}
+
+// orderEmailData is what the order email templates render
+type orderEmailData struct {
+	Name        string
+	Order       *models.Order
+	Refund      *models.Refund
+	Reason      string
+	CourierName string
+	OrderURL    string
+	AdminURL    string
+}
+
+// emailTemplate holds the subject and bodies of one kind of email
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// emailTemplates are parsed once at startup, so a broken template fails fast
+var emailTemplates = parseEmailTemplates(
+	EmailOrderPlaced, EmailPaymentReceived, EmailOrderShipped, EmailOrderDelivered,
+	EmailOrderCancelled, EmailOrderRefunded, EmailAdminOrderPlaced, EmailAdminPaymentReceived,
+	EmailWelcome, EmailLowStock,
+)
+
+// parseEmailTemplates parses the subject and text body of templates/email/<kind>.txt
+// and the HTML body of templates/email/<kind>.html inside the shared layout
+func parseEmailTemplates(kinds ...string) map[string]emailTemplate {
+	templates := make(map[string]emailTemplate, len(kinds))
+	for _, kind := range kinds {
+		templates[kind] = emailTemplate{
+			text: texttemplate.Must(texttemplate.New(kind).Funcs(emailTemplateFuncs).
+				ParseFS(emailTemplateFS, "templates/email/"+kind+".txt")),
+			html: htmltemplate.Must(htmltemplate.New(kind).Funcs(emailTemplateFuncs).
+				ParseFS(emailTemplateFS, "templates/email/layout.html", "templates/email/"+kind+".html")),
+		}
+	}
+	return templates
+}
+
+// renderEmail renders one kind of email
+func renderEmail(kind string, data interface{}) (Email, error) {
+	tmpl, ok := emailTemplates[kind]
+	if !ok {
+		return Email{}, fmt.Errorf("unknown email %q", kind)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Email{}, err
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return Email{}, err
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return Email{}, err
+	}
+
+	return Email{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// orderRecipient returns the address and name order emails go to: the
+// customer's account, or the details given at guest checkout
+func orderRecipient(tx *gorm.DB, order *models.Order) (string, string, error) {
+	if order.UserID == nil {
+		return order.GuestEmail, order.GuestName, nil
+	}
+	var user models.User
+	if err := tx.Select("email", "name").First(&user, "id = ?", *order.UserID).Error; err != nil {
+		return "", "", err
+	}
+	return user.Email, user.Name, nil
+}
+
+// orderURL links the customer to their order; guests go to order tracking
+func orderURL(order *models.Order) string {
+	base := strings.TrimSuffix(orderEmails.FrontendURL, "/")
+	if order.UserID == nil {
+		return base + "/track-order?" + url.Values{"order": {order.OrderNumber}, "email": {order.GuestEmail}}.Encode()
+	}
+	return base + "/orders/" + order.ID.String()
+}
+
+// courierName returns the display name of a courier code
+func courierName(code string) string {
+	for _, courier := range SupportedCouriers {
+		if courier.Code == code {
+			return courier.Name
+		}
+	}
+	return strings.ToUpper(code)
+}
+
+// EnqueueEmail queues an email in the outbox inside tx, so it is only sent if
+// the change it reports is committed
+func EnqueueEmail(tx *gorm.DB, kind string, email Email, order *models.Order) error {
+	if email.To == "" {
+		return nil
+	}
+	record := models.OutboundEmail{
+		Kind:          kind,
+		To:            email.To,
+		Subject:       email.Subject,
+		Text:          email.Text,
+		HTML:          email.HTML,
+		Status:        models.EmailStatusPending,
+		NextAttemptAt: tx.NowFunc(),
+	}
+	if order != nil {
+		record.OrderID = &order.ID
+	}
+	return tx.Create(&record).Error
+}
+
+// EnqueueOrderEmail renders an order email for the customer, and for the
+// admin where there is an admin copy, and queues it inside tx. An email that
+// cannot be rendered is logged and skipped rather than failing the change.
+func EnqueueOrderEmail(tx *gorm.DB, kind string, order *models.Order, reason string, refund *models.Refund) error {
+	to, name, err := orderRecipient(tx, order)
+	if err != nil {
+		return err
+	}
+
+	data := orderEmailData{
+		Name:        name,
+		Order:       order,
+		Refund:      refund,
+		Reason:      reason,
+		CourierName: courierName(order.Courier),
+		OrderURL:    orderURL(order),
+		AdminURL:    strings.TrimSuffix(orderEmails.FrontendURL, "/") + "/admin/orders/" + order.ID.String(),
+	}
+
+	email, err := renderEmail(kind, data)
+	if err != nil {
+		log.Printf("Failed to render %s email for order %s: %v", kind, order.OrderNumber, err)
+	} else {
+		email.To = to
+		if err := EnqueueEmail(tx, kind, email, order); err != nil {
+			return err
+		}
+	}
+
+	adminKind := ""
+	switch kind {
+	case EmailOrderPlaced:
+		adminKind = EmailAdminOrderPlaced
+	case EmailPaymentReceived:
+		adminKind = EmailAdminPaymentReceived
+	}
+	if adminKind == "" || orderEmails.AdminEmail == "" {
+		return nil
+	}
+
+	email, err = renderEmail(adminKind, data)
+	if err != nil {
+		log.Printf("Failed to render %s email for order %s: %v", adminKind, order.OrderNumber, err)
+		return nil
+	}
+	email.To = orderEmails.AdminEmail
+	return EnqueueEmail(tx, adminKind, email, order)
+}
+
+// orderStatusEmails maps the order statuses customers are told about to their email
+var orderStatusEmails = map[models.OrderStatus]string{
+	models.OrderStatusPaid:      EmailPaymentReceived,
+	models.OrderStatusShipped:   EmailOrderShipped,
+	models.OrderStatusDelivered: EmailOrderDelivered,
+	models.OrderStatusCancelled: EmailOrderCancelled,
+}
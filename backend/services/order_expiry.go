@@ -0,0 +1,74 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"nexora-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExpirePendingOrders cancels pending orders created before now minus ttl,
+// expires their pending payments and restores their stock. Each order is
+// handled in its own transaction and locked with FOR UPDATE SKIP LOCKED, so
+// several replicas can run this at the same time without touching the same order.
+func ExpirePendingOrders(db *gorm.DB, ttl time.Duration) (int, error) {
+	cutoff := time.Now().Add(-ttl)
+	expired := 0
+
+	for {
+		found, err := expireNextPendingOrder(db, cutoff)
+		if err != nil {
+			return expired, err
+		}
+		if !found {
+			return expired, nil
+		}
+		expired++
+	}
+}
+
+// expireNextPendingOrder expires the oldest unlocked pending order before cutoff.
+// It reports false when there is nothing left to expire.
+func expireNextPendingOrder(db *gorm.DB, cutoff time.Time) (bool, error) {
+	found := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND created_at < ?", models.OrderStatusPending, cutoff).
+			Order("created_at asc").Limit(1).
+			Find(&order)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		found = true
+
+		if err := tx.Where("order_id = ?", order.ID).Find(&order.Items).Error; err != nil {
+			return err
+		}
+
+		if err := CancelOrder(tx, &order, SystemActor, "Payment window expired", models.StockReasonPaymentExpired); err != nil {
+			return err
+		}
+
+		// The order is locked before its payments, as in ApplyNotification
+		payments := tx.Model(&models.Payment{}).
+			Where("order_id = ? AND status = ?", order.ID, models.PaymentStatusPending).
+			Update("status", models.PaymentStatusExpired)
+		if payments.Error != nil {
+			return payments.Error
+		}
+
+		log.Printf("Expired pending order %s (%s) created at %s: restored stock for %d items, expired %d payments",
+			order.OrderNumber, order.ID, order.CreatedAt.Format(time.RFC3339), len(order.Items), payments.RowsAffected)
+		return nil
+	})
+
+	return found, err
+}
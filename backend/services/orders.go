@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Actor roles recorded in the order status history
+const (
+	ActorCustomer = "customer"
+	ActorAdmin    = "admin"
+	ActorGuest    = "guest"
+	ActorSystem   = "system"
+)
+
+var (
+	// ErrInvalidStatus is returned for a status that is not a models.OrderStatus
+	ErrInvalidStatus = errors.New("invalid order status")
+	// ErrInvalidTransition is returned when the state machine forbids a move
+	ErrInvalidTransition = errors.New("order status transition not allowed")
+	// ErrStaleOrder is returned when the order changed status concurrently
+	ErrStaleOrder = errors.New("order status changed concurrently")
+)
+
+// Actor identifies who triggered an order status change
+type Actor struct {
+	UserID *uuid.UUID
+	Role   string
+}
+
+// SystemActor is used for changes made by webhooks and background jobs
+var SystemActor = Actor{Role: ActorSystem}
+
+// RecordInitialStatus writes the first history entry for a newly created order
+func RecordInitialStatus(tx *gorm.DB, order *models.Order, actor Actor) error {
+	return tx.Create(&models.OrderStatusHistory{
+		OrderID:   order.ID,
+		ToStatus:  order.Status,
+		ActorID:   actor.UserID,
+		ActorRole: actor.Role,
+		Reason:    "Order placed",
+	}).Error
+}
+
+// TransitionOrder moves an order to a new status if the state machine allows it
+// and records the change in the status history. The update is conditional on the
+// order still having its previous status, so concurrent transitions cannot both win.
+// Statuses customers are told about queue an email, and every change publishes
+// EventOrderStatusChanged (plus the event of the new status, if it has one), in
+// the same transaction.
+func TransitionOrder(tx *gorm.DB, order *models.Order, to models.OrderStatus, actor Actor, reason string) error {
+	if !to.IsValid() {
+		return ErrInvalidStatus
+	}
+
+	from := order.Status
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+
+	updates := map[string]interface{}{"status": to}
+	now := time.Now()
+	switch to {
+	case models.OrderStatusShipped:
+		order.ShippedAt = &now
+		updates["shipped_at"] = now
+	case models.OrderStatusDelivered:
+		order.DeliveredAt = &now
+		updates["delivered_at"] = now
+	}
+
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, from).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStaleOrder
+	}
+	order.Status = to
+
+	if err := tx.Create(&models.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actor.UserID,
+		ActorRole:  actor.Role,
+		Reason:     reason,
+	}).Error; err != nil {
+		return err
+	}
+
+	event := NewOrderEvent(order, from, actor, reason)
+	if err := PublishEvent(tx, EventOrderStatusChanged, order.ID, event); err != nil {
+		return err
+	}
+	if eventType, ok := orderStatusEvents[to]; ok {
+		if err := PublishEvent(tx, eventType, order.ID, event); err != nil {
+			return err
+		}
+	}
+
+	// Tell the customer, once the change commits
+	if kind, ok := orderStatusEmails[to]; ok {
+		return EnqueueOrderEmail(tx, kind, order, reason, nil)
+	}
+	return nil
+}
+
+// orderStatusEvents maps order statuses to the domain event published on reaching them
+var orderStatusEvents = map[models.OrderStatus]string{
+	models.OrderStatusPaid:      EventOrderPaid,
+	models.OrderStatusShipped:   EventOrderShipped,
+	models.OrderStatusCancelled: EventOrderCancelled,
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"nexora-backend/config"
+)
+
+// Payment providers selectable through PAYMENT_PROVIDER
+const (
+	ProviderMidtrans = "midtrans"
+	ProviderFake     = "fake"
+)
+
+// Transaction statuses reported by payment gateways (Midtrans vocabulary)
+const (
+	TransactionPending       = "pending"
+	TransactionCapture       = "capture"
+	TransactionSettlement    = "settlement"
+	TransactionDeny          = "deny"
+	TransactionCancel        = "cancel"
+	TransactionExpire        = "expire"
+	TransactionRefund        = "refund"
+	TransactionPartialRefund = "partial_refund"
+)
+
+var (
+	// ErrInvalidSignature is returned when a notification signature does not match
+	ErrInvalidSignature = errors.New("invalid notification signature")
+	// ErrMalformedNotification is returned when a notification cannot be parsed
+	ErrMalformedNotification = errors.New("malformed notification")
+	// ErrTransactionNotFound is returned when the gateway does not know a transaction
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrRefundRejected is returned when the gateway definitely declined a
+	// refund, as opposed to a timeout or server error that leaves it unknown
+	ErrRefundRejected = errors.New("refund rejected by the gateway")
+)
+
+// ChargeRequest describes a payment to be created at the gateway
+type ChargeRequest struct {
+	Reference     string // gateway-side order ID, stored as Payment.MidtransID
+	Amount        float64
+	CustomerName  string
+	CustomerEmail string
+	CustomerPhone string
+	FinishURL     string
+}
+
+// Charge is the result of creating a payment at the gateway
+type Charge struct {
+	Token       string
+	RedirectURL string
+}
+
+// GatewayTransaction is the state of a transaction as reported by the gateway,
+// either through a notification or a status query
+type GatewayTransaction struct {
+	Reference         string `json:"order_id"`
+	TransactionID     string `json:"transaction_id"`
+	TransactionStatus string `json:"transaction_status"`
+	StatusCode        string `json:"status_code"`
+	GrossAmount       string `json:"gross_amount"`
+	PaymentType       string `json:"payment_type"`
+	FraudStatus       string `json:"fraud_status"`
+	SignatureKey      string `json:"signature_key"`
+
+	// Set on refund and partial_refund notifications
+	RefundAmount string          `json:"refund_amount,omitempty"` // total refunded so far
+	Refunds      []GatewayRefund `json:"refunds,omitempty"`
+}
+
+// GatewayRefund is one refund of a transaction as reported by the gateway
+type GatewayRefund struct {
+	ID        json.Number `json:"refund_chargeback_id"`
+	RefundKey string      `json:"refund_key"`
+	Amount    string      `json:"refund_amount"`
+	Reason    string      `json:"reason"`
+}
+
+// RefundRequest describes a full or partial refund of a settled transaction
+type RefundRequest struct {
+	Reference string
+	RefundKey string // idempotency key for the refund at the gateway
+	Amount    float64
+	Reason    string
+}
+
+// RefundResult is the gateway's answer to a refund request
+type RefundResult struct {
+	ID                string // gateway-side refund reference
+	RefundKey         string
+	TransactionStatus string
+}
+
+// PaymentGateway is implemented by every payment provider
+type PaymentGateway interface {
+	// Name returns the provider name
+	Name() string
+	// CreateCharge creates a payment and returns the token/URL the customer pays with
+	CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	// VerifyNotification parses a webhook body and checks its signature
+	VerifyNotification(body []byte) (*GatewayTransaction, error)
+	// QueryStatus asks the gateway for the current state of a transaction
+	QueryStatus(ctx context.Context, reference string) (*GatewayTransaction, error)
+	// Refund returns all or part of a settled payment to the customer
+	Refund(ctx context.Context, req RefundRequest) (*RefundResult, error)
+}
+
+// NewPaymentGateway returns the gateway selected by the configuration
+func NewPaymentGateway(cfg *config.Config) (PaymentGateway, error) {
+	switch cfg.PaymentProvider {
+	case ProviderMidtrans:
+		return NewMidtransGateway(cfg.MidtransServerKey, cfg.MidtransIsProduction), nil
+	case ProviderFake:
+		if cfg.Env == "production" {
+			return nil, errors.New("fake payment provider is not available in production")
+		}
+		return NewFakeGateway(cfg.APIURL), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", cfg.PaymentProvider)
+	}
+}
+
+// notificationSignature computes the Midtrans-style signature of a notification
+func notificationSignature(txn *GatewayTransaction, serverKey string) string {
+	hash := sha512.Sum512([]byte(txn.Reference + txn.StatusCode + txn.GrossAmount + serverKey))
+	return hex.EncodeToString(hash[:])
+}
+
+// parseSignedNotification decodes a notification body and verifies its signature
+func parseSignedNotification(body []byte, serverKey string) (*GatewayTransaction, error) {
+	var txn GatewayTransaction
+	if err := json.Unmarshal(body, &txn); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedNotification, err)
+	}
+	if txn.Reference == "" || txn.StatusCode == "" || txn.GrossAmount == "" || txn.TransactionStatus == "" {
+		return nil, fmt.Errorf("%w: missing required fields", ErrMalformedNotification)
+	}
+	if !hmac.Equal([]byte(txn.SignatureKey), []byte(notificationSignature(&txn, serverKey))) {
+		return nil, ErrInvalidSignature
+	}
+	return &txn, nil
+}
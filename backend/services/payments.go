@@ -0,0 +1,256 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"nexora-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPaymentNotFound is returned when no payment matches a gateway reference
+var ErrPaymentNotFound = errors.New("payment not found")
+
+// Where a transaction update came from
+const (
+	NotificationSourceWebhook     = "webhook"
+	NotificationSourceStatusQuery = "status_query"
+	NotificationSourceReconcile   = "reconcile"
+	NotificationSourceFake        = "fake"
+	NotificationSourceReplay      = "replay"
+)
+
+// FraudChallenge marks a card capture held for manual review at the gateway
+const FraudChallenge = "challenge"
+
+// notificationKey identifies a transaction update for idempotency. Refund
+// updates repeat their status, so the refunded total is part of their key.
+func notificationKey(txn *GatewayTransaction) string {
+	id := txn.TransactionID
+	if id == "" {
+		id = txn.Reference
+	}
+	key := id + ":" + txn.TransactionStatus
+	if txn.TransactionStatus == TransactionRefund || txn.TransactionStatus == TransactionPartialRefund {
+		key += ":" + txn.RefundAmount
+	}
+	return key
+}
+
+// RecordNotification stores a transaction update as it was received. verifyErr
+// is the error from parsing or verifying it; such updates are stored as rejected
+// with whatever could be read from the payload.
+func RecordNotification(db *gorm.DB, source string, payload []byte, txn *GatewayTransaction, verifyErr error) *models.PaymentNotification {
+	record := models.PaymentNotification{
+		Source:  source,
+		Payload: string(payload),
+		Outcome: models.NotificationReceived,
+	}
+
+	fields := txn
+	if fields == nil {
+		fields = &GatewayTransaction{}
+		json.Unmarshal(payload, fields)
+	}
+	record.Reference = fields.Reference
+	record.TransactionID = fields.TransactionID
+	record.TransactionStatus = fields.TransactionStatus
+	record.FraudStatus = fields.FraudStatus
+	record.GrossAmount = fields.GrossAmount
+	record.IdempotencyKey = notificationKey(fields)
+
+	if verifyErr != nil {
+		now := time.Now()
+		record.Outcome = models.NotificationRejected
+		record.Detail = verifyErr.Error()
+		record.ProcessedAt = &now
+	}
+
+	if err := db.Create(&record).Error; err != nil {
+		log.Printf("Failed to store payment notification for %s: %v", record.Reference, err)
+	}
+	return &record
+}
+
+// finishNotification stores the outcome of a recorded transaction update
+func finishNotification(db *gorm.DB, record *models.PaymentNotification, outcome models.NotificationOutcome, detail string) error {
+	now := time.Now()
+	record.Outcome = outcome
+	record.Detail = detail
+	record.ProcessedAt = &now
+	return db.Model(&models.PaymentNotification{}).Where("id = ?", record.ID).Updates(map[string]interface{}{
+		"outcome":      outcome,
+		"detail":       detail,
+		"payment_id":   record.PaymentID,
+		"processed_at": now,
+	}).Error
+}
+
+// ApplyNotification applies a recorded transaction update to its payment and
+// order in one database transaction, and stores the outcome on the record.
+// Updates that were already applied, and updates that would move a payment
+// backwards (a late expire after settlement, say), change nothing.
+func ApplyNotification(db *gorm.DB, record *models.PaymentNotification, txn *GatewayTransaction) (*models.Payment, error) {
+	var payment models.Payment
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id", "order_id").Where("midtrans_id = ?", txn.Reference).First(&payment).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPaymentNotFound
+			}
+			return err
+		}
+
+		// Lock the order before the payment, in the same order as the expiry
+		// reaper, so the two cannot deadlock. The payment row lock serializes
+		// concurrent updates of one transaction.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			First(&models.Order{}, "id = ?", payment.OrderID).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, "id = ?", payment.ID).Error; err != nil {
+			return err
+		}
+		record.PaymentID = &payment.ID
+
+		var applied int64
+		if err := tx.Model(&models.PaymentNotification{}).
+			Where("idempotency_key = ? AND outcome = ? AND id != ?", record.IdempotencyKey, models.NotificationApplied, record.ID).
+			Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			return finishNotification(tx, record, models.NotificationDuplicate, "")
+		}
+
+		outcome, detail, err := applyTransaction(tx, &payment, txn)
+		if err != nil {
+			return err
+		}
+		return finishNotification(tx, record, outcome, detail)
+	})
+	if err != nil {
+		if finishErr := finishNotification(db, record, models.NotificationFailed, err.Error()); finishErr != nil {
+			log.Printf("Failed to store payment notification outcome for %s: %v", txn.Reference, finishErr)
+		}
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// ApplyTransaction records and applies a transaction state reported other than
+// by a webhook, such as a status query. A transaction that is still pending
+// changes nothing and is not stored.
+func ApplyTransaction(db *gorm.DB, source string, txn *GatewayTransaction) (*models.Payment, *models.PaymentNotification, error) {
+	if txn.TransactionStatus == TransactionPending {
+		var payment models.Payment
+		if err := db.Where("midtrans_id = ?", txn.Reference).First(&payment).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, ErrPaymentNotFound
+			}
+			return nil, nil, err
+		}
+		return &payment, &models.PaymentNotification{
+			Source:            source,
+			Reference:         txn.Reference,
+			TransactionStatus: txn.TransactionStatus,
+			Outcome:           models.NotificationIgnored,
+			Detail:            "transaction still pending",
+		}, nil
+	}
+
+	payload, err := json.Marshal(txn)
+	if err != nil {
+		return nil, nil, err
+	}
+	record := RecordNotification(db, source, payload, txn, nil)
+	payment, err := ApplyNotification(db, record, txn)
+	return payment, record, err
+}
+
+// applyTransaction moves a locked payment and its order to the state the
+// gateway reports, unless that would be a step backwards
+func applyTransaction(tx *gorm.DB, payment *models.Payment, txn *GatewayTransaction) (models.NotificationOutcome, string, error) {
+	var order models.Order
+	if err := tx.Preload("Items").First(&order, "id = ?", payment.OrderID).Error; err != nil {
+		return "", "", err
+	}
+
+	detail := ""
+	switch txn.TransactionStatus {
+	case TransactionCapture, TransactionSettlement:
+		if txn.FraudStatus == FraudChallenge {
+			return models.NotificationIgnored, "capture is held for fraud review", nil
+		}
+		switch payment.Status {
+		case models.PaymentStatusSuccess, models.PaymentStatusPartiallyRefunded, models.PaymentStatusRefunded:
+			return models.NotificationIgnored, fmt.Sprintf("payment is already %s", payment.Status), nil
+		}
+		// A settlement for another amount than was charged is not this payment
+		if amount, err := strconv.ParseFloat(txn.GrossAmount, 64); err != nil || math.Round(amount) != math.Round(payment.Amount) {
+			log.Printf("Payment %s settled for %s, expected %.0f", payment.MidtransID, txn.GrossAmount, payment.Amount)
+			return models.NotificationRejected, fmt.Sprintf("gross amount %s does not match payment amount %.0f", txn.GrossAmount, payment.Amount), nil
+		}
+
+		payment.Status = models.PaymentStatusSuccess
+		now := time.Now()
+		payment.PaidAt = &now
+		payment.Method = txn.PaymentType
+
+		// Update order status to paid (admin will approve to set processing)
+		if order.Status.CanTransitionTo(models.OrderStatusPaid) {
+			if err := TransitionOrder(tx, &order, models.OrderStatusPaid, SystemActor, "Payment "+txn.TransactionStatus); err != nil {
+				return "", "", err
+			}
+		} else {
+			// Money arrived for an order we already gave up on; it has to be refunded by hand
+			detail = fmt.Sprintf("order is %s; payment needs to be refunded", order.Status)
+			log.Printf("Payment %s settled for %s order %s", payment.MidtransID, order.Status, order.OrderNumber)
+		}
+
+	case TransactionDeny, TransactionCancel, TransactionExpire:
+		if payment.Status != models.PaymentStatusPending {
+			return models.NotificationIgnored, fmt.Sprintf("payment is already %s", payment.Status), nil
+		}
+
+		payment.Status = models.PaymentStatusFailed
+		if txn.TransactionStatus == TransactionExpire {
+			payment.Status = models.PaymentStatusExpired
+		}
+
+		// Cancel the order, restoring stock and releasing any coupon use
+		if order.Status.CanTransitionTo(models.OrderStatusCancelled) {
+			reason := models.StockReasonOrderCancelled
+			if txn.TransactionStatus == TransactionExpire {
+				reason = models.StockReasonPaymentExpired
+			}
+			if err := CancelOrder(tx, &order, SystemActor, "Payment "+txn.TransactionStatus, reason); err != nil {
+				return "", "", err
+			}
+		}
+
+	case TransactionRefund, TransactionPartialRefund:
+		if payment.Status == models.PaymentStatusPending || payment.Status == models.PaymentStatusFailed ||
+			payment.Status == models.PaymentStatusExpired {
+			return models.NotificationIgnored, fmt.Sprintf("payment is %s and cannot be refunded", payment.Status), nil
+		}
+		if err := applyRefundNotification(tx, payment, txn); err != nil {
+			return "", "", err
+		}
+
+	default:
+		return models.NotificationIgnored, fmt.Sprintf("status %q changes nothing", txn.TransactionStatus), nil
+	}
+
+	if err := tx.Save(payment).Error; err != nil {
+		return "", "", err
+	}
+	return models.NotificationApplied, detail, nil
+}
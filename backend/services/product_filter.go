@@ -0,0 +1,289 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ProductFilter is what a product listing is narrowed by. Values within one
+// facet are alternatives (Size XL or L); different facets all have to match
+// (Size XL and Color Red).
+type ProductFilter struct {
+	Search          string
+	SearchMode      string // full text unless FallBackToFuzzySearch switched it
+	CategoryIDs     []uuid.UUID
+	Attributes      map[string][]string // variant name -> accepted values
+	InStock         bool
+	MinRating       float64
+	MinPrice        *float64 // compared with the base price plus variant modifier
+	MaxPrice        *float64
+	FeaturedOnly    bool
+	IncludeInactive bool
+}
+
+// Facets a filter condition belongs to, so facet counts can leave their own
+// condition out
+const (
+	facetCategory  = "category"
+	facetAttribute = "attribute:"
+	facetInStock   = "in_stock"
+	facetRating    = "rating"
+	facetPrice     = "price"
+)
+
+// liveVariants matches the variants of the product row being filtered
+const liveVariants = "product_variants.product_id = products.id AND product_variants.deleted_at IS NULL"
+
+// avgRating is the average review rating of the product row being filtered
+const avgRating = "(SELECT COALESCE(AVG(reviews.rating), 0) FROM reviews WHERE reviews.product_id = products.id AND reviews.deleted_at IS NULL)"
+
+// FallBackToFuzzySearch switches a search that full text found nothing for to
+// fuzzy name matching for the rest of the transaction tx. It reports false
+// when there is no search or it is already fuzzy.
+func (f *ProductFilter) FallBackToFuzzySearch(tx *gorm.DB) (bool, error) {
+	if f.Search == "" || f.SearchMode == SearchModeFuzzy {
+		return false, nil
+	}
+	if err := SetFuzzySearchThreshold(tx); err != nil {
+		return false, err
+	}
+	f.SearchMode = SearchModeFuzzy
+	return true, nil
+}
+
+// Apply narrows a query on products to the filter
+func (f ProductFilter) Apply(query *gorm.DB) *gorm.DB {
+	return f.apply(query, "")
+}
+
+// apply narrows a query on products to every filter condition except the
+// ones of the skipped facet
+func (f ProductFilter) apply(query *gorm.DB, skip string) *gorm.DB {
+	if !f.IncludeInactive {
+		query = query.Where("products.is_active = ?", true)
+	}
+	if f.FeaturedOnly {
+		query = query.Where("products.is_featured = ?", true)
+	}
+
+	switch {
+	case f.Search == "":
+	case f.SearchMode == SearchModeFuzzy:
+		query = FuzzySearch(query, f.Search)
+	default:
+		query = FullTextSearch(query, f.Search)
+	}
+
+	if len(f.CategoryIDs) > 0 && skip != facetCategory {
+		query = query.Where("products.category_id IN ?", f.CategoryIDs)
+	}
+
+	for _, name := range f.attributeNames() {
+		if skip == facetAttribute+name {
+			continue
+		}
+		// Variants out of stock don't count when only stocked products are wanted
+		inStock := ""
+		if f.InStock && skip != facetInStock {
+			inStock = " AND product_variants.stock > 0"
+		}
+		query = query.Where("EXISTS (SELECT 1 FROM product_variants WHERE "+liveVariants+
+			" AND LOWER(product_variants.name) = LOWER(?) AND LOWER(product_variants.value) IN ?"+inStock+")",
+			name, lowerAll(f.Attributes[name]))
+	}
+
+	if f.InStock && skip != facetInStock {
+		query = query.Where("products.stock > 0")
+	}
+
+	if f.MinRating > 0 && skip != facetRating {
+		query = query.Where(avgRating+" >= ?", f.MinRating)
+	}
+
+	if (f.MinPrice != nil || f.MaxPrice != nil) && skip != facetPrice {
+		query = f.applyPrice(query)
+	}
+
+	return query
+}
+
+// applyPrice keeps products with at least one price in range: a variant's
+// base price plus modifier, or the base price of a product without variants
+func (f ProductFilter) applyPrice(query *gorm.DB) *gorm.DB {
+	minPrice, maxPrice := -1.0, -1.0 // a negative bound is no bound
+	if f.MinPrice != nil {
+		minPrice = *f.MinPrice
+	}
+	if f.MaxPrice != nil {
+		maxPrice = *f.MaxPrice
+	}
+	inRange := func(price string) string {
+		return "(@min < 0 OR " + price + " >= @min) AND (@max < 0 OR " + price + " <= @max)"
+	}
+
+	return query.Where(
+		"((NOT EXISTS (SELECT 1 FROM product_variants WHERE "+liveVariants+") AND "+inRange("products.base_price")+")"+
+			" OR EXISTS (SELECT 1 FROM product_variants WHERE "+liveVariants+" AND "+inRange("products.base_price + product_variants.price_modifier")+"))",
+		map[string]interface{}{"min": minPrice, "max": maxPrice},
+	)
+}
+
+// attributeNames returns the filtered variant names in a stable order
+func (f ProductFilter) attributeNames() []string {
+	names := make([]string, 0, len(f.Attributes))
+	for name, values := range f.Attributes {
+		if len(values) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(value)
+	}
+	return lowered
+}
+
+// FacetValue is one value of a facet and how many products it would show
+type FacetValue struct {
+	Value    string `json:"value"`
+	Label    string `json:"label,omitempty"`
+	Count    int64  `json:"count"`
+	Selected bool   `json:"selected"`
+}
+
+// PriceRange is the lowest and highest price among the products
+type PriceRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// ProductFacets are the counts a filter sidebar is built from. Each facet is
+// counted with every other filter applied but not its own, so choosing one
+// category still shows how many products the other categories have.
+type ProductFacets struct {
+	Categories []FacetValue            `json:"categories"`
+	Attributes map[string][]FacetValue `json:"attributes"` // keyed by variant name
+	InStock    int64                   `json:"in_stock"`
+	Ratings    []FacetValue            `json:"ratings"` // products rated at least Value
+	Price      PriceRange              `json:"price"`
+}
+
+// ratingFacets are the minimum ratings offered as filters
+var ratingFacets = []int{4, 3, 2, 1}
+
+// ProductFacetCounts counts the facets of the products matching a filter
+func ProductFacetCounts(db *gorm.DB, f ProductFilter) (*ProductFacets, error) {
+	facets := &ProductFacets{Attributes: map[string][]FacetValue{}}
+	products := func(skip string) *gorm.DB {
+		return f.apply(db.Model(&models.Product{}), skip)
+	}
+
+	// Categories
+	selectedCategories := map[string]bool{}
+	for _, id := range f.CategoryIDs {
+		selectedCategories[id.String()] = true
+	}
+	if err := products(facetCategory).
+		Joins("JOIN categories ON categories.id = products.category_id").
+		Select("products.category_id::text AS value, categories.name AS label, COUNT(*) AS count").
+		Group("products.category_id, categories.name").Order("categories.name").
+		Scan(&facets.Categories).Error; err != nil {
+		return nil, err
+	}
+	for i := range facets.Categories {
+		facets.Categories[i].Selected = selectedCategories[facets.Categories[i].Value]
+	}
+
+	// Variant attributes: names without a selection are counted together, each
+	// selected name on its own without its own condition
+	type attributeCount struct {
+		Name  string
+		Value string
+		Count int64
+	}
+	selectedNames := f.attributeNames()
+	variantJoin := "JOIN product_variants ON " + liveVariants
+	if f.InStock {
+		variantJoin += " AND product_variants.stock > 0"
+	}
+	attributeQuery := func(query *gorm.DB) *gorm.DB {
+		return query.Joins(variantJoin).
+			Select("product_variants.name AS name, product_variants.value AS value, COUNT(DISTINCT products.id) AS count").
+			Group("product_variants.name, product_variants.value").
+			Order("product_variants.name, product_variants.value")
+	}
+
+	var counts []attributeCount
+	query := attributeQuery(products(""))
+	if len(selectedNames) > 0 {
+		query = query.Where("LOWER(product_variants.name) NOT IN ?", lowerAll(selectedNames))
+	}
+	if err := query.Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, name := range selectedNames {
+		var selected []attributeCount
+		if err := attributeQuery(products(facetAttribute+name)).
+			Where("LOWER(product_variants.name) = LOWER(?)", name).
+			Scan(&selected).Error; err != nil {
+			return nil, err
+		}
+		counts = append(counts, selected...)
+	}
+
+	for _, count := range counts {
+		selected := false
+		for name, values := range f.Attributes {
+			if strings.EqualFold(name, count.Name) {
+				for _, value := range values {
+					selected = selected || strings.EqualFold(value, count.Value)
+				}
+			}
+		}
+		facets.Attributes[count.Name] = append(facets.Attributes[count.Name], FacetValue{
+			Value:    count.Value,
+			Count:    count.Count,
+			Selected: selected,
+		})
+	}
+
+	// In stock
+	if err := products(facetInStock).Where("products.stock > 0").Count(&facets.InStock).Error; err != nil {
+		return nil, err
+	}
+
+	// Minimum ratings
+	for _, rating := range ratingFacets {
+		var count int64
+		if err := products(facetRating).Where(avgRating+" >= ?", rating).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		facets.Ratings = append(facets.Ratings, FacetValue{
+			Value:    strconv.Itoa(rating),
+			Count:    count,
+			Selected: f.MinRating == float64(rating),
+		})
+	}
+
+	// Price range, including variant modifiers
+	if err := products(facetPrice).
+		Joins("LEFT JOIN product_variants ON " + liveVariants).
+		Select("COALESCE(MIN(products.base_price + COALESCE(product_variants.price_modifier, 0)), 0) AS min, " +
+			"COALESCE(MAX(products.base_price + COALESCE(product_variants.price_modifier, 0)), 0) AS max").
+		Scan(&facets.Price).Error; err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
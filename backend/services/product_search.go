@@ -0,0 +1,173 @@
+package services
+
+import (
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// searchConfig is the Postgres text search configuration products are indexed
+// with; it decides stemming, so "shirts" finds "shirt"
+const searchConfig = "english"
+
+// fuzzySearchThreshold is the minimum pg_trgm word similarity for the typo
+// fallback to count a product name as a match
+const fuzzySearchThreshold = 0.3
+
+// Search modes reported with search results
+const (
+	SearchModeFullText = "fulltext"
+	SearchModeFuzzy    = "fuzzy"
+)
+
+// productSearchSetup keeps products.search_vector up to date. The vector
+// weighs the name highest, then category name and variant values, then the
+// description. Variant and category triggers refresh the products they belong
+// to by touching search_vector, which fires the product trigger.
+var productSearchSetup = []string{
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+	`CREATE OR REPLACE FUNCTION products_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('` + searchConfig + `', coalesce(NEW.name, '')), 'A') ||
+		setweight(to_tsvector('` + searchConfig + `', coalesce((SELECT name FROM categories WHERE id = NEW.category_id), '')), 'B') ||
+		setweight(to_tsvector('` + searchConfig + `', coalesce((SELECT string_agg(name || ' ' || value, ' ') FROM product_variants
+			WHERE product_id = NEW.id AND deleted_at IS NULL), '')), 'B') ||
+		setweight(to_tsvector('` + searchConfig + `', coalesce(NEW.description, '')), 'C');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS products_search_vector ON products`,
+	`CREATE TRIGGER products_search_vector BEFORE INSERT OR UPDATE OF name, description, category_id, search_vector
+		ON products FOR EACH ROW EXECUTE FUNCTION products_search_vector_update()`,
+	`CREATE OR REPLACE FUNCTION product_variants_search_refresh() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP <> 'INSERT' THEN
+		UPDATE products SET search_vector = NULL WHERE id = OLD.product_id;
+	END IF;
+	IF TG_OP <> 'DELETE' THEN
+		UPDATE products SET search_vector = NULL WHERE id = NEW.product_id;
+	END IF;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS product_variants_search_refresh ON product_variants`,
+	`CREATE TRIGGER product_variants_search_refresh AFTER INSERT OR DELETE OR UPDATE OF name, value, product_id, deleted_at
+		ON product_variants FOR EACH ROW EXECUTE FUNCTION product_variants_search_refresh()`,
+	`CREATE OR REPLACE FUNCTION categories_search_refresh() RETURNS trigger AS $$
+BEGIN
+	UPDATE products SET search_vector = NULL WHERE category_id = NEW.id;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS categories_search_refresh ON categories`,
+	`CREATE TRIGGER categories_search_refresh AFTER UPDATE OF name ON categories
+		FOR EACH ROW EXECUTE FUNCTION categories_search_refresh()`,
+	`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`,
+	`CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops)`,
+	// Index products that predate the trigger
+	`UPDATE products SET search_vector = NULL WHERE search_vector IS NULL`,
+}
+
+// EnsureProductSearch creates the product search column, its triggers and
+// indexes, and indexes existing products. It is safe to run on every start.
+func EnsureProductSearch(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range productSearchSetup {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// searchQuery is the tsquery for what a customer typed; websearch syntax
+// accepts quotes, "or" and -exclusions and never fails to parse
+func searchQuery(term string) clause.Expr {
+	return gorm.Expr("websearch_to_tsquery('"+searchConfig+"', ?)", term)
+}
+
+// FullTextSearch narrows a product query to products matching term
+func FullTextSearch(query *gorm.DB, term string) *gorm.DB {
+	return query.Where("products.search_vector @@ ?", searchQuery(term))
+}
+
+// FuzzySearch narrows a product query to products whose name is close to
+// term, for searches that found nothing because of a typo. The <% operator
+// can use the trigram index and matches by pg_trgm.word_similarity_threshold,
+// so run it in a transaction after SetFuzzySearchThreshold.
+func FuzzySearch(query *gorm.DB, term string) *gorm.DB {
+	return query.Where("? <% products.name", term)
+}
+
+// SetFuzzySearchThreshold sets the word similarity FuzzySearch matches by for
+// the rest of the transaction tx
+func SetFuzzySearchThreshold(tx *gorm.DB) error {
+	return tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)",
+		strconv.FormatFloat(fuzzySearchThreshold, 'f', -1, 64)).Error
+}
+
+// SearchRankOrder orders products by how well they match term, best first. It
+// is an expression, so apply it with clause.OrderBy.
+func SearchRankOrder(term, mode string) clause.Expr {
+	if mode == SearchModeFuzzy {
+		return gorm.Expr("word_similarity(?, products.name) DESC", term)
+	}
+	return gorm.Expr("ts_rank(products.search_vector, ?) DESC", searchQuery(term))
+}
+
+// Sentinels ts_headline wraps matches in; they survive HTML escaping and are
+// then swapped for <mark> tags
+const (
+	highlightStart = "[[[mark]]]"
+	highlightStop  = "[[[/mark]]]"
+)
+
+// SearchHighlight is a product's name and description excerpt with the
+// matched words wrapped in <mark>. Everything else is HTML escaped.
+type SearchHighlight struct {
+	Name    string `json:"name"`
+	Snippet string `json:"snippet"`
+}
+
+// SearchHighlights returns highlights for the given products, keyed by product
+// ID. Highlighting is only worth its cost for the page being shown.
+func SearchHighlights(db *gorm.DB, term string, productIDs []uuid.UUID) map[uuid.UUID]SearchHighlight {
+	highlights := map[uuid.UUID]SearchHighlight{}
+	if len(productIDs) == 0 {
+		return highlights
+	}
+
+	var rows []struct {
+		ID      uuid.UUID
+		Name    string
+		Snippet string
+	}
+	options := `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `"`
+	err := db.Table("products").
+		Select("id, ts_headline('"+searchConfig+"', name, ?, ?) AS name, ts_headline('"+searchConfig+"', description, ?, ?) AS snippet",
+			searchQuery(term), options+", HighlightAll=true",
+			searchQuery(term), options+", MaxWords=25, MinWords=10, MaxFragments=2").
+		Where("id IN ?", productIDs).Scan(&rows).Error
+	if err != nil {
+		log.Printf("Failed to highlight search results for %q: %v", term, err)
+		return highlights
+	}
+
+	for _, row := range rows {
+		highlights[row.ID] = SearchHighlight{Name: markHighlights(row.Name), Snippet: markHighlights(row.Snippet)}
+	}
+	return highlights
+}
+
+// markHighlights escapes a ts_headline result and turns its sentinels into <mark> tags
+func markHighlights(text string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(text))
+}
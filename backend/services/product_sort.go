@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+
+	"nexora-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Product sort keys
+const (
+	ProductSortRelevance   = "relevance" // searches only
+	ProductSortNewest      = "newest"
+	ProductSortPriceAsc    = "price_asc"
+	ProductSortPriceDesc   = "price_desc"
+	ProductSortBestSelling = "best_selling"
+	ProductSortTopRated    = "top_rated"
+	ProductSortName        = "name"
+)
+
+var (
+	// ErrUnknownSort is returned for a sort key that is not offered
+	ErrUnknownSort = errors.New("unknown sort")
+	// ErrInvalidSortOrder is returned for a sort direction other than asc or desc
+	ErrInvalidSortOrder = errors.New("sort order must be asc or desc")
+)
+
+// soldStatuses are the order statuses whose items count as sold
+var soldStatuses = []models.OrderStatus{
+	models.OrderStatusPaid,
+	models.OrderStatusProcessing,
+	models.OrderStatusShipped,
+	models.OrderStatusDelivered,
+}
+
+// Sort columns of the product row being ordered
+const (
+	// fromPrice is the lowest price a product sells at, variant modifiers included
+	fromPrice = "COALESCE((SELECT MIN(products.base_price + product_variants.price_modifier) FROM product_variants WHERE " +
+		liveVariants + "), products.base_price)"
+	// unitsSold is how many units of a product were sold in orders that were paid for
+	unitsSold = "(SELECT COALESCE(SUM(order_items.quantity), 0) FROM order_items JOIN orders ON orders.id = order_items.order_id" +
+		" WHERE order_items.product_id = products.id AND order_items.deleted_at IS NULL AND orders.deleted_at IS NULL" +
+		" AND orders.status IN ?)"
+	// reviewCount is how many reviews a product has
+	reviewCount = "(SELECT COUNT(*) FROM reviews WHERE reviews.product_id = products.id AND reviews.deleted_at IS NULL)"
+)
+
+// productSort is a sort key: its columns and the direction of the first one
+// when none is asked for. Later columns break ties in a fixed direction.
+type productSort struct {
+	column      string
+	vars        []interface{}
+	defaultDesc bool
+	tiebreakers string
+}
+
+// newestFirst breaks ties so that every sort has one stable order
+const newestFirst = "products.created_at DESC, products.id DESC"
+
+var productSorts = map[string]productSort{
+	ProductSortNewest:      {column: "products.created_at", defaultDesc: true, tiebreakers: "products.id DESC"},
+	ProductSortPriceAsc:    {column: fromPrice, tiebreakers: newestFirst},
+	ProductSortPriceDesc:   {column: fromPrice, defaultDesc: true, tiebreakers: newestFirst},
+	ProductSortBestSelling: {column: unitsSold, vars: []interface{}{soldStatuses}, defaultDesc: true, tiebreakers: newestFirst},
+	ProductSortTopRated:    {column: avgRating, defaultDesc: true, tiebreakers: reviewCount + " DESC, " + newestFirst},
+	ProductSortName:        {column: "LOWER(products.name)", tiebreakers: newestFirst},
+}
+
+// ProductSortKeys lists the sort keys offered for products
+var ProductSortKeys = []string{
+	ProductSortRelevance,
+	ProductSortNewest,
+	ProductSortPriceAsc,
+	ProductSortPriceDesc,
+	ProductSortBestSelling,
+	ProductSortTopRated,
+	ProductSortName,
+}
+
+// ProductSortOrder returns the ORDER BY for a product listing. An empty key
+// sorts searches by relevance and everything else newest first; an empty
+// order uses the key's own direction. The result is an expression, so apply
+// it with clause.OrderBy.
+func ProductSortOrder(f ProductFilter, key, order string) (clause.Expr, error) {
+	if order != "" && order != "asc" && order != "desc" {
+		return clause.Expr{}, ErrInvalidSortOrder
+	}
+	if key == "" {
+		key = ProductSortNewest
+		if f.Search != "" {
+			key = ProductSortRelevance
+		}
+	}
+
+	// Relevance is always best match first
+	if key == ProductSortRelevance {
+		if f.Search == "" {
+			return clause.Expr{}, ErrUnknownSort
+		}
+		return gorm.Expr("?, "+newestFirst, SearchRankOrder(f.Search, f.SearchMode)), nil
+	}
+
+	sort, ok := productSorts[key]
+	if !ok {
+		return clause.Expr{}, ErrUnknownSort
+	}
+	direction := " ASC"
+	if order == "desc" || (order == "" && sort.defaultDesc) {
+		direction = " DESC"
+	}
+	return gorm.Expr(sort.column+direction+", "+sort.tiebreakers, sort.vars...), nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PaymentMismatch is a pending payment the gateway reported in another state,
+// usually because its webhook never reached us
+type PaymentMismatch struct {
+	PaymentID     uuid.UUID                  `json:"payment_id"`
+	OrderID       uuid.UUID                  `json:"order_id"`
+	Reference     string                     `json:"reference"`
+	LocalStatus   models.PaymentStatus       `json:"local_status"`
+	GatewayStatus string                     `json:"gateway_status"`
+	NewStatus     models.PaymentStatus       `json:"new_status,omitempty"`
+	Outcome       models.NotificationOutcome `json:"outcome"`
+	Detail        string                     `json:"detail,omitempty"`
+}
+
+// ReconcileReport summarizes a reconciliation run
+type ReconcileReport struct {
+	Checked    int               `json:"checked"`
+	NotFound   int               `json:"not_found"`
+	Failed     int               `json:"failed"`
+	Mismatches []PaymentMismatch `json:"mismatches"`
+}
+
+// ReconcilePayments asks the gateway for the state of every payment that is
+// still pending and was created between from and to (a zero from means no
+// lower bound), and applies what it reports the same way a webhook would.
+func ReconcilePayments(ctx context.Context, db *gorm.DB, gateway PaymentGateway, from, to time.Time) (*ReconcileReport, error) {
+	query := db.Where("status = ? AND created_at < ?", models.PaymentStatusPending, to)
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+
+	var payments []models.Payment
+	if err := query.Order("created_at asc").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{Mismatches: []PaymentMismatch{}}
+	for _, payment := range payments {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		report.Checked++
+
+		txn, err := gateway.QueryStatus(ctx, payment.MidtransID)
+		if err != nil {
+			// The customer never opened the payment page; the order expiry job handles it
+			if errors.Is(err, ErrTransactionNotFound) {
+				report.NotFound++
+				continue
+			}
+			log.Printf("Reconcile: failed to query payment %s: %v", payment.MidtransID, err)
+			report.Failed++
+			continue
+		}
+		if txn.TransactionStatus == TransactionPending {
+			continue
+		}
+
+		mismatch := PaymentMismatch{
+			PaymentID:     payment.ID,
+			OrderID:       payment.OrderID,
+			Reference:     payment.MidtransID,
+			LocalStatus:   payment.Status,
+			GatewayStatus: txn.TransactionStatus,
+		}
+
+		updated, record, err := ApplyTransaction(db, NotificationSourceReconcile, txn)
+		if err != nil {
+			log.Printf("Reconcile: failed to apply %s for payment %s: %v", txn.TransactionStatus, payment.MidtransID, err)
+			report.Failed++
+			mismatch.Outcome = models.NotificationFailed
+			mismatch.Detail = err.Error()
+		} else {
+			mismatch.NewStatus = updated.Status
+			mismatch.Outcome = record.Outcome
+			mismatch.Detail = record.Detail
+		}
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+
+	return report, nil
+}
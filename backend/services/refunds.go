@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrPaymentNotRefundable is returned for a payment that was never settled or is fully refunded
+	ErrPaymentNotRefundable = errors.New("payment cannot be refunded")
+	// ErrInvalidRefundAmount is returned for a negative refund amount
+	ErrInvalidRefundAmount = errors.New("refund amount must be greater than 0")
+	// ErrRefundExceedsPayment is returned when a refund is more than is left to refund
+	ErrRefundExceedsPayment = errors.New("refund exceeds the refundable amount")
+	// ErrRefundFailed is returned when the gateway rejected a refund
+	ErrRefundFailed = errors.New("gateway refused the refund")
+	// ErrRefundPending is returned when the gateway's answer to a refund is
+	// unknown; the refund stays pending until a notification or a retry settles it
+	ErrRefundPending = errors.New("refund outcome is not known yet")
+)
+
+// RefundablePayment reports whether money can still be returned for a payment
+func RefundablePayment(payment *models.Payment) bool {
+	return payment.Status == models.PaymentStatusSuccess || payment.Status == models.PaymentStatusPartiallyRefunded
+}
+
+// RefundPayment returns amount (the whole refundable balance when 0) of a
+// payment to the customer through the gateway. The refund is recorded as
+// pending before the gateway is called, so concurrent requests cannot refund
+// the same money twice, and is settled or failed from the gateway's answer.
+func RefundPayment(ctx context.Context, db *gorm.DB, gateway PaymentGateway, paymentID uuid.UUID, amount float64, reason string, actor Actor) (*models.Refund, error) {
+	var refund *models.Refund
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		refund, err = CreateRefund(tx, paymentID, amount, reason, actor)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refund, SendRefund(ctx, db, gateway, refund)
+}
+
+// CreateRefund records a pending refund of amount (the whole refundable
+// balance when 0) inside tx, holding the amount against the payment until
+// SendRefund settles it
+func CreateRefund(tx *gorm.DB, paymentID uuid.UUID, amount float64, reason string, actor Actor) (*models.Refund, error) {
+	if amount < 0 {
+		return nil, ErrInvalidRefundAmount
+	}
+
+	var payment models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, "id = ?", paymentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+	if !RefundablePayment(&payment) {
+		return nil, fmt.Errorf("%w: payment is %s", ErrPaymentNotRefundable, payment.Status)
+	}
+
+	// Pending refunds hold their amount until the gateway answers
+	var held float64
+	if err := tx.Model(&models.Refund{}).
+		Where("payment_id = ? AND status IN ?", payment.ID, []models.RefundStatus{models.RefundStatusPending, models.RefundStatusSucceeded}).
+		Select("COALESCE(SUM(amount), 0)").Scan(&held).Error; err != nil {
+		return nil, err
+	}
+
+	refundable := payment.Amount - held
+	if amount == 0 {
+		amount = refundable
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: nothing left to refund", ErrRefundExceedsPayment)
+	}
+	if amount > refundable {
+		return nil, fmt.Errorf("%w of %.0f", ErrRefundExceedsPayment, refundable)
+	}
+
+	var count int64
+	if err := tx.Model(&models.Refund{}).Where("payment_id = ?", payment.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+
+	refund := models.Refund{
+		PaymentID: payment.ID,
+		OrderID:   payment.OrderID,
+		Amount:    amount,
+		Reason:    reason,
+		Status:    models.RefundStatusPending,
+		RefundKey: fmt.Sprintf("%s-R%d", payment.MidtransID, count+1),
+		ActorID:   actor.UserID,
+		ActorRole: actor.Role,
+	}
+	if err := tx.Create(&refund).Error; err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// SendRefund asks the gateway to pay out a pending refund and stores the
+// outcome. Sending the same refund again reuses its refund key, so the gateway
+// pays it once. Only a definite rejection fails the refund (ErrRefundFailed);
+// a timeout or server error leaves it pending (ErrRefundPending), as the money
+// may have moved.
+func SendRefund(ctx context.Context, db *gorm.DB, gateway PaymentGateway, refund *models.Refund) error {
+	var payment models.Payment
+	if err := db.First(&payment, "id = ?", refund.PaymentID).Error; err != nil {
+		return err
+	}
+
+	result, err := gateway.Refund(ctx, RefundRequest{
+		Reference: payment.MidtransID,
+		RefundKey: refund.RefundKey,
+		Amount:    refund.Amount,
+		Reason:    refund.Reason,
+	})
+	if err != nil && !errors.Is(err, ErrRefundRejected) {
+		return fmt.Errorf("%w: %v", ErrRefundPending, err)
+	}
+	if err != nil {
+		// A notification may have settled the refund in the meantime
+		failed := db.Model(&models.Refund{}).
+			Where("id = ? AND status = ?", refund.ID, models.RefundStatusPending).
+			Updates(map[string]interface{}{
+				"status":         models.RefundStatusFailed,
+				"failure_reason": err.Error(),
+			})
+		if failed.Error != nil {
+			return failed.Error
+		}
+		if failed.RowsAffected == 0 {
+			return db.First(refund, "id = ?", refund.ID).Error
+		}
+		refund.Status = models.RefundStatusFailed
+		refund.FailureReason = err.Error()
+		return fmt.Errorf("%w: %v", ErrRefundFailed, err)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := settleRefund(tx, refund, result.ID); err != nil {
+			return err
+		}
+		return syncPaymentRefunds(tx, &payment)
+	})
+}
+
+// settleRefund marks a refund succeeded unless it already is, and tells the
+// customer. The update is conditional, so when a notification and the
+// gateway's answer race only one of them settles the refund and sends the email.
+func settleRefund(tx *gorm.DB, refund *models.Refund, providerReference string) error {
+	now := time.Now()
+	settled := tx.Model(&models.Refund{}).
+		Where("id = ? AND status <> ?", refund.ID, models.RefundStatusSucceeded).
+		Updates(map[string]interface{}{
+			"status":             models.RefundStatusSucceeded,
+			"provider_reference": providerReference,
+			"failure_reason":     "",
+			"completed_at":       now,
+		})
+	if settled.Error != nil {
+		return settled.Error
+	}
+	if settled.RowsAffected == 0 {
+		return tx.First(refund, "id = ?", refund.ID).Error
+	}
+
+	refund.Status = models.RefundStatusSucceeded
+	refund.ProviderReference = providerReference
+	refund.FailureReason = ""
+	refund.CompletedAt = &now
+	return enqueueRefundEmail(tx, refund)
+}
+
+// applyRefundNotification records the refunds a gateway reports for a payment.
+// Refunds we started are settled by refund key; refunds made directly at the
+// gateway (for example from its dashboard) are added.
+func applyRefundNotification(tx *gorm.DB, payment *models.Payment, txn *GatewayTransaction) error {
+	now := time.Now()
+	for _, reported := range txn.Refunds {
+		amount, err := strconv.ParseFloat(reported.Amount, 64)
+		if err != nil {
+			return fmt.Errorf("%w: refund amount %q", ErrMalformedNotification, reported.Amount)
+		}
+
+		refundKey := reported.RefundKey
+		if refundKey == "" {
+			refundKey = fmt.Sprintf("%s-gateway-%s", payment.MidtransID, reported.ID.String())
+		}
+
+		var refund models.Refund
+		result := tx.Where("refund_key = ?", refundKey).Limit(1).Find(&refund)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			if err := settleRefund(tx, &refund, reported.ID.String()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		refund = models.Refund{
+			PaymentID:         payment.ID,
+			OrderID:           payment.OrderID,
+			Amount:            amount,
+			Reason:            reported.Reason,
+			Status:            models.RefundStatusSucceeded,
+			RefundKey:         refundKey,
+			ProviderReference: reported.ID.String(),
+			ActorRole:         ActorSystem,
+			CompletedAt:       &now,
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+		if err := enqueueRefundEmail(tx, &refund); err != nil {
+			return err
+		}
+	}
+
+	return syncPaymentRefunds(tx, payment)
+}
+
+// enqueueRefundEmail tells the customer about a refund that succeeded
+func enqueueRefundEmail(tx *gorm.DB, refund *models.Refund) error {
+	var order models.Order
+	if err := tx.First(&order, "id = ?", refund.OrderID).Error; err != nil {
+		return err
+	}
+	return EnqueueOrderEmail(tx, EmailOrderRefunded, &order, refund.Reason, refund)
+}
+
+// syncPaymentRefunds recomputes the refunded amount and status of a payment
+// from its succeeded refunds
+func syncPaymentRefunds(tx *gorm.DB, payment *models.Payment) error {
+	var refunded float64
+	if err := tx.Model(&models.Refund{}).
+		Where("payment_id = ? AND status = ?", payment.ID, models.RefundStatusSucceeded).
+		Select("COALESCE(SUM(amount), 0)").Scan(&refunded).Error; err != nil {
+		return err
+	}
+
+	payment.RefundedAmount = refunded
+	switch {
+	case refunded <= 0:
+		return nil
+	case math.Round(refunded) >= math.Round(payment.Amount):
+		payment.Status = models.PaymentStatusRefunded
+	default:
+		payment.Status = models.PaymentStatusPartiallyRefunded
+	}
+
+	return tx.Model(&models.Payment{}).Where("id = ?", payment.ID).Updates(map[string]interface{}{
+		"refunded_amount": payment.RefundedAmount,
+		"status":          payment.Status,
+	}).Error
+}
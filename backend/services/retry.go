@@ -0,0 +1,16 @@
+package services
+
+import "time"
+
+// Backoff returns how long to wait before retrying something that failed
+// attempts times: base after the first failure, doubling each time up to max
+func Backoff(attempts int, base, max time.Duration) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOrderNotDelivered is returned for a return on an order that was not delivered
+	ErrOrderNotDelivered = errors.New("only delivered orders can be returned")
+	// ErrReturnWindowClosed is returned for a return opened after the return window
+	ErrReturnWindowClosed = errors.New("the return window for this order has closed")
+	// ErrInvalidReturnItems is returned for return lines that are not items of the order or claim too much
+	ErrInvalidReturnItems = errors.New("invalid return items")
+	// ErrInvalidReturnTransition is returned for a return status change that is not allowed
+	ErrInvalidReturnTransition = errors.New("invalid return status transition")
+	// ErrStaleReturn is returned when a return changed since it was loaded
+	ErrStaleReturn = errors.New("return was modified concurrently")
+)
+
+// ReturnLine is a quantity of one order item a customer wants to send back
+type ReturnLine struct {
+	OrderItemID uuid.UUID
+	Quantity    int
+}
+
+// OpenReturn creates a return request for items of a delivered order within
+// window of its delivery. The order must have its Items loaded.
+func OpenReturn(tx *gorm.DB, order *models.Order, lines []ReturnLine, reason string, photoURLs []string, actor Actor, window time.Duration) (*models.ReturnRequest, error) {
+	if order.Status != models.OrderStatusDelivered || order.DeliveredAt == nil {
+		return nil, ErrOrderNotDelivered
+	}
+	if time.Since(*order.DeliveredAt) > window {
+		return nil, ErrReturnWindowClosed
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: no items selected", ErrInvalidReturnItems)
+	}
+
+	ordered := make(map[uuid.UUID]models.OrderItem, len(order.Items))
+	for _, item := range order.Items {
+		ordered[item.ID] = item
+	}
+
+	// Quantities already held by other open returns of this order
+	var held []struct {
+		OrderItemID uuid.UUID
+		Quantity    int
+	}
+	if err := tx.Table("return_items").
+		Select("return_items.order_item_id, SUM(return_items.quantity) AS quantity").
+		Joins("JOIN return_requests ON return_requests.id = return_items.return_id").
+		Where("return_requests.order_id = ? AND return_requests.status NOT IN ?", order.ID,
+			[]models.ReturnStatus{models.ReturnStatusRejected, models.ReturnStatusCancelled}).
+		Group("return_items.order_item_id").Scan(&held).Error; err != nil {
+		return nil, err
+	}
+	returned := make(map[uuid.UUID]int, len(held))
+	for _, h := range held {
+		returned[h.OrderItemID] = h.Quantity
+	}
+
+	requested := make(map[uuid.UUID]int, len(lines))
+	for _, line := range lines {
+		item, ok := ordered[line.OrderItemID]
+		if !ok {
+			return nil, fmt.Errorf("%w: item %s is not part of this order", ErrInvalidReturnItems, line.OrderItemID)
+		}
+		if line.Quantity < 1 {
+			return nil, fmt.Errorf("%w: quantity for %s must be at least 1", ErrInvalidReturnItems, item.ProductName)
+		}
+		requested[line.OrderItemID] += line.Quantity
+		if returned[line.OrderItemID]+requested[line.OrderItemID] > item.Quantity {
+			return nil, fmt.Errorf("%w: only %d of %s can still be returned", ErrInvalidReturnItems,
+				item.Quantity-returned[line.OrderItemID], item.ProductName)
+		}
+	}
+
+	ret := models.ReturnRequest{
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		Status:    models.ReturnStatusRequested,
+		Reason:    reason,
+		PhotoURLs: photoURLs,
+	}
+	for id, quantity := range requested {
+		ret.Items = append(ret.Items, models.ReturnItem{OrderItemID: id, Quantity: quantity})
+	}
+	if err := tx.Create(&ret).Error; err != nil {
+		return nil, err
+	}
+
+	history := models.ReturnStatusHistory{
+		ReturnID:  ret.ID,
+		ToStatus:  ret.Status,
+		ActorID:   actor.UserID,
+		ActorRole: actor.Role,
+		Note:      "Return requested",
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return nil, err
+	}
+	ret.History = []models.ReturnStatusHistory{history}
+
+	return &ret, nil
+}
+
+// TransitionReturn moves a return to a new status if allowed and records it in
+// the return history. Like TransitionOrder, the update only applies while the
+// return still has its previous status.
+func TransitionReturn(tx *gorm.DB, ret *models.ReturnRequest, to models.ReturnStatus, actor Actor, note string) error {
+	from := ret.Status
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidReturnTransition, from, to)
+	}
+
+	updates := map[string]interface{}{"status": to}
+	now := time.Now()
+	switch to {
+	case models.ReturnStatusReceived:
+		ret.ReceivedAt = &now
+		updates["received_at"] = now
+	case models.ReturnStatusRejected, models.ReturnStatusCancelled, models.ReturnStatusCompleted:
+		ret.ResolvedAt = &now
+		updates["resolved_at"] = now
+	}
+	if note != "" && actor.Role == ActorAdmin {
+		ret.AdminNote = note
+		updates["admin_note"] = note
+	}
+
+	result := tx.Model(&models.ReturnRequest{}).
+		Where("id = ? AND status = ?", ret.ID, from).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStaleReturn
+	}
+	ret.Status = to
+
+	return tx.Create(&models.ReturnStatusHistory{
+		ReturnID:   ret.ID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actor.UserID,
+		ActorRole:  actor.Role,
+		Note:       note,
+	}).Error
+}
+
+// RestockReturn puts the returned quantities back into stock. The return must
+// have its Items loaded with their OrderItem.
+func RestockReturn(tx *gorm.DB, ret *models.ReturnRequest, actor Actor) error {
+	for _, item := range ret.Items {
+		if err := ApplyStockChange(tx, StockChange{
+			ProductID:   item.OrderItem.ProductID,
+			VariantID:   item.OrderItem.VariantID,
+			Delta:       item.Quantity,
+			Reason:      models.StockReasonReturnRestocked,
+			ReferenceID: &ret.ID,
+			Actor:       actor,
+		}); err != nil {
+			return err
+		}
+	}
+
+	ret.Restocked = true
+	return tx.Model(&models.ReturnRequest{}).Where("id = ?", ret.ID).Update("restocked", true).Error
+}
+
+// ReturnValue is what the returned items were paid for. The return must have
+// its Items loaded with their OrderItem.
+func ReturnValue(ret *models.ReturnRequest) float64 {
+	var value float64
+	for _, item := range ret.Items {
+		value += item.OrderItem.Price * float64(item.Quantity)
+	}
+	return value
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"nexora-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IsSupportedCourier reports whether code is a courier the store ships with
+func IsSupportedCourier(code string) bool {
+	code = strings.ToLower(code)
+	for _, courier := range SupportedCouriers {
+		if courier.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyShipment records new tracking events on a shipped order and marks it
+// delivered, with the courier's delivery time, once the courier reports delivery
+func ApplyShipment(db *gorm.DB, order *models.Order, shipment *Shipment) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, event := range shipment.Events {
+			record := models.ShipmentEvent{
+				OrderID:     order.ID,
+				Time:        event.Time,
+				Status:      event.Status,
+				Description: event.Description,
+				Location:    event.Location,
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		order.TrackingStatus = shipment.Status
+		order.TrackingCheckedAt = &now
+		if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+			"tracking_status":     shipment.Status,
+			"tracking_checked_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		if shipment.Status != TrackingStatusDelivered || !order.Status.CanTransitionTo(models.OrderStatusDelivered) {
+			return nil
+		}
+
+		if err := TransitionOrder(tx, order, models.OrderStatusDelivered, SystemActor, "Delivered by "+shipment.CourierName); err != nil {
+			return err
+		}
+		if shipment.DeliveredAt != nil && !shipment.DeliveredAt.IsZero() {
+			order.DeliveredAt = shipment.DeliveredAt
+			return tx.Model(&models.Order{}).Where("id = ?", order.ID).
+				Update("delivered_at", *shipment.DeliveredAt).Error
+		}
+		return nil
+	})
+}
+
+// SyncShippedOrders polls the courier of up to limit shipped orders, least
+// recently checked first, and applies what they report. It returns how many
+// orders were marked delivered.
+func SyncShippedOrders(ctx context.Context, db *gorm.DB, registry *CourierRegistry, limit int) (int, error) {
+	var orders []models.Order
+	if err := db.Where("status = ? AND courier != '' AND tracking_number != ''", models.OrderStatusShipped).
+		Order("tracking_checked_at asc nulls first").Limit(limit).Find(&orders).Error; err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for i := range orders {
+		order := &orders[i]
+		if ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+
+		shipment, err := registry.Track(ctx, order.Courier, order.TrackingNumber)
+		if err != nil {
+			// Keep polling the rest; an unsupported or unknown shipment is retried on the next run
+			if !errors.Is(err, ErrShipmentNotFound) {
+				log.Printf("Shipment tracking: order %s (%s %s): %v", order.OrderNumber, order.Courier, order.TrackingNumber, err)
+			}
+			db.Model(&models.Order{}).Where("id = ?", order.ID).Update("tracking_checked_at", time.Now())
+			continue
+		}
+
+		if err := ApplyShipment(db, order, shipment); err != nil {
+			if errors.Is(err, ErrStaleOrder) {
+				continue
+			}
+			return delivered, err
+		}
+		if order.Status == models.OrderStatusDelivered {
+			delivered++
+			log.Printf("Shipment tracking: order %s delivered by %s", order.OrderNumber, shipment.CourierName)
+		}
+	}
+	return delivered, nil
+}
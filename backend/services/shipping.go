@@ -0,0 +1,205 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strings"
+
+	"nexora-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultItemWeight is charged, in grams, for products without a recorded weight
+const DefaultItemWeight = 1000
+
+var (
+	// ErrUnknownCourier is returned for a courier that is unknown or switched off
+	ErrUnknownCourier = errors.New("courier is not available")
+	// ErrNoShippingZone is returned when no active zone, not even a default one, covers a destination
+	ErrNoShippingZone = errors.New("no shipping zone covers the destination")
+	// ErrNoShippingRate is returned when the zone has no rate band for a parcel's weight
+	ErrNoShippingRate = errors.New("no shipping rate for this weight")
+)
+
+// ShippingDestination is the part of an address that shipping rates depend on
+type ShippingDestination struct {
+	State      string `json:"state"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code"`
+}
+
+// ShippingQuote is the fee for sending a parcel with one courier
+type ShippingQuote struct {
+	Courier      string  `json:"courier"`
+	CourierName  string  `json:"courier_name"`
+	Zone         string  `json:"zone"`
+	Weight       int     `json:"weight"` // grams
+	Fee          float64 `json:"fee"`
+	FreeShipping bool    `json:"free_shipping"`
+}
+
+// ItemWeight returns the shipping weight in grams of one unit of a product or variant
+func ItemWeight(product models.Product, variant *models.ProductVariant) int {
+	if variant != nil && variant.Weight > 0 {
+		return variant.Weight
+	}
+	if product.Weight > 0 {
+		return product.Weight
+	}
+	return DefaultItemWeight
+}
+
+// QuoteShipping prices a parcel of the given weight to a destination. An empty
+// courier code quotes every active courier, cheapest first.
+func QuoteShipping(db *gorm.DB, dest ShippingDestination, weight int, courier string, subtotal float64) ([]ShippingQuote, error) {
+	zone, err := findShippingZone(db, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := zoneRate(zone, weight)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Where("is_active = ?", true)
+	if courier != "" {
+		query = query.Where("code = ?", strings.ToLower(courier))
+	}
+	var couriers []models.ShippingCourier
+	if err := query.Order("multiplier asc, code asc").Find(&couriers).Error; err != nil {
+		return nil, err
+	}
+	if len(couriers) == 0 {
+		return nil, ErrUnknownCourier
+	}
+
+	free := zone.FreeShippingMin > 0 && subtotal > zone.FreeShippingMin
+	quotes := make([]ShippingQuote, len(couriers))
+	for i, c := range couriers {
+		quote := ShippingQuote{
+			Courier:      c.Code,
+			CourierName:  c.Name,
+			Zone:         zone.Name,
+			Weight:       weight,
+			FreeShipping: free,
+		}
+		if !free {
+			quote.Fee = math.Round(base * c.Multiplier)
+		}
+		quotes[i] = quote
+	}
+	return quotes, nil
+}
+
+// findShippingZone returns the active zone with the most specific region match,
+// falling back to the default zone
+func findShippingZone(db *gorm.DB, dest ShippingDestination) (*models.ShippingZone, error) {
+	var zones []models.ShippingZone
+	if err := db.Preload("Regions").Preload("Rates", func(db *gorm.DB) *gorm.DB {
+		return db.Order("min_weight asc")
+	}).Where("is_active = ?", true).Find(&zones).Error; err != nil {
+		return nil, err
+	}
+
+	var best, fallback *models.ShippingZone
+	bestScore := 0
+	for i := range zones {
+		zone := &zones[i]
+		if zone.IsDefault && fallback == nil {
+			fallback = zone
+		}
+		for _, region := range zone.Regions {
+			if score := regionScore(region, dest); score > bestScore {
+				best, bestScore = zone, score
+			}
+		}
+	}
+
+	if best != nil {
+		return best, nil
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, ErrNoShippingZone
+}
+
+// regionScore rates how specifically a region matches a destination, 0 = no match
+func regionScore(region models.ShippingZoneRegion, dest ShippingDestination) int {
+	score := 0
+	if region.State != "" {
+		if !strings.EqualFold(strings.TrimSpace(region.State), strings.TrimSpace(dest.State)) {
+			return 0
+		}
+		score += 1
+	}
+	if region.City != "" {
+		if !strings.EqualFold(strings.TrimSpace(region.City), strings.TrimSpace(dest.City)) {
+			return 0
+		}
+		score += 2
+	}
+	if region.PostalPrefix != "" {
+		if !strings.HasPrefix(strings.TrimSpace(dest.PostalCode), region.PostalPrefix) {
+			return 0
+		}
+		score += 4 + len(region.PostalPrefix)
+	}
+	return score
+}
+
+// zoneRate prices a weight with the zone's matching weight band
+func zoneRate(zone *models.ShippingZone, weight int) (float64, error) {
+	for _, rate := range zone.Rates {
+		if weight < rate.MinWeight || (rate.MaxWeight > 0 && weight >= rate.MaxWeight) {
+			continue
+		}
+		extraKg := math.Ceil(float64(weight-rate.MinWeight) / 1000)
+		return rate.Fee + extraKg*rate.PerKgFee, nil
+	}
+	return 0, ErrNoShippingRate
+}
+
+// EnsureShippingRates creates a nationwide default zone and the courier list
+// when the rate tables have never been set up. The default zone keeps the old flat rate of
+// 15,000 IDR with free shipping above 500,000 IDR.
+func EnsureShippingRates(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var zones int64
+		if err := tx.Unscoped().Model(&models.ShippingZone{}).Count(&zones).Error; err != nil {
+			return err
+		}
+		if zones == 0 {
+			zone := models.ShippingZone{
+				Name:            "Indonesia",
+				IsDefault:       true,
+				FreeShippingMin: 500000,
+				IsActive:        true,
+				Rates:           []models.ShippingRate{{MinWeight: 0, Fee: 15000}},
+			}
+			if err := tx.Create(&zone).Error; err != nil {
+				return err
+			}
+			log.Println("Created default shipping zone")
+		}
+
+		var couriers int64
+		if err := tx.Unscoped().Model(&models.ShippingCourier{}).Count(&couriers).Error; err != nil {
+			return err
+		}
+		if couriers == 0 {
+			list := make([]models.ShippingCourier, len(SupportedCouriers))
+			for i, courier := range SupportedCouriers {
+				list[i] = models.ShippingCourier{Code: courier.Code, Name: courier.Name, Multiplier: 1, IsActive: true}
+			}
+			if err := tx.Create(&list).Error; err != nil {
+				return err
+			}
+			log.Printf("Created %d default shipping couriers", len(list))
+		}
+		return nil
+	})
+}
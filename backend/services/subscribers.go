@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"nexora-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Emails sent by event subscribers, named after their templates in templates/email
+const (
+	EmailWelcome  = "welcome"
+	EmailLowStock = "low_stock"
+)
+
+// RegisterEventSubscribers subscribes the built-in features to domain events
+func RegisterEventSubscribers(bus *EventBus) {
+	bus.Subscribe(EventUserRegistered, "welcome-email", sendWelcomeEmail)
+	bus.Subscribe(EventStockLow, "low-stock-email", sendLowStockEmail)
+
+	for eventType := range webhookEvents {
+		bus.Subscribe(eventType, "webhooks", queueWebhookDeliveries)
+	}
+}
+
+// sendWelcomeEmail queues a welcome email for a new account
+func sendWelcomeEmail(ctx context.Context, db *gorm.DB, event Event) error {
+	var payload UserRegisteredEvent
+	if err := event.Decode(&payload); err != nil {
+		return err
+	}
+
+	email, err := renderEmail(EmailWelcome, map[string]interface{}{
+		"Name":    payload.Name,
+		"ShopURL": strings.TrimSuffix(orderEmails.FrontendURL, "/") + "/products",
+	})
+	if err != nil {
+		return err
+	}
+	email.To = payload.Email
+	return EnqueueEmail(db, EmailWelcome, email, nil)
+}
+
+// sendLowStockEmail queues a low stock alert for the admin
+func sendLowStockEmail(ctx context.Context, db *gorm.DB, event Event) error {
+	if orderEmails.AdminEmail == "" {
+		return nil
+	}
+
+	var payload StockLowEvent
+	if err := event.Decode(&payload); err != nil {
+		return err
+	}
+
+	var product models.Product
+	if err := db.Unscoped().Select("id", "name").First(&product, "id = ?", payload.ProductID).Error; err != nil {
+		return err
+	}
+	name := product.Name
+	if payload.VariantID != nil {
+		var variant models.ProductVariant
+		if err := db.Unscoped().First(&variant, "id = ?", *payload.VariantID).Error; err != nil {
+			return err
+		}
+		name += " (" + variant.Name + ": " + variant.Value + ")"
+	}
+
+	email, err := renderEmail(EmailLowStock, map[string]interface{}{
+		"ProductName": name,
+		"Stock":       payload.Stock,
+		"Threshold":   payload.Threshold,
+		"AdminURL":    strings.TrimSuffix(orderEmails.FrontendURL, "/") + "/admin/products/" + payload.ProductID.String(),
+	})
+	if err != nil {
+		return err
+	}
+	email.To = orderEmails.AdminEmail
+	return EnqueueEmail(db, EmailLowStock, email, nil)
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"nexora-backend/config"
+)
+
+// Normalized shipment statuses reported by every courier tracker
+const (
+	TrackingStatusProcessing     = "processing"
+	TrackingStatusInTransit      = "in_transit"
+	TrackingStatusOutForDelivery = "out_for_delivery"
+	TrackingStatusDeliveryFailed = "delivery_failed" // an attempt failed; the courier will retry or return it
+	TrackingStatusDelivered      = "delivered"
+	TrackingStatusReturned       = "returned"
+	TrackingStatusUnknown        = "unknown"
+)
+
+// CourierMock is the courier code of the dummy tracker used in development
+const CourierMock = "mock"
+
+var (
+	ErrUnsupportedCourier = errors.New("courier tracking is not supported")
+	ErrShipmentNotFound   = errors.New("shipment not found")
+)
+
+// Courier is a delivery company shipments can be tracked with
+type Courier struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// SupportedCouriers are the couriers the store ships with
+var SupportedCouriers = []Courier{
+	{Code: "jne", Name: "JNE Express"},
+	{Code: "jnt", Name: "J&T Express"},
+	{Code: "sicepat", Name: "SiCepat Express"},
+	{Code: "pos", Name: "POS Indonesia"},
+	{Code: "anteraja", Name: "AnterAja"},
+	{Code: "ninja", Name: "Ninja Express"},
+	{Code: "lion", Name: "Lion Parcel"},
+	{Code: "ide", Name: "ID Express"},
+	{Code: "spx", Name: "Shopee Express"},
+	{Code: "lex", Name: "Lazada Logistics"},
+}
+
+// TrackingEvent is one step of a shipment's journey
+type TrackingEvent struct {
+	Time        time.Time `json:"time"`
+	Status      string    `json:"status"`
+	Description string    `json:"description"`
+	Location    string    `json:"location,omitempty"`
+}
+
+// Shipment is the normalized tracking state of a parcel. Events are oldest first.
+type Shipment struct {
+	TrackingNumber string          `json:"tracking_number"`
+	Courier        string          `json:"courier"`
+	CourierName    string          `json:"courier_name"`
+	Status         string          `json:"status"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	Events         []TrackingEvent `json:"events"`
+	FetchedAt      time.Time       `json:"fetched_at"`
+}
+
+// CourierTracker looks up shipments with one or more couriers
+type CourierTracker interface {
+	Track(ctx context.Context, courier Courier, trackingNumber string) (*Shipment, error)
+}
+
+type trackingCacheEntry struct {
+	shipment *Shipment
+	expires  time.Time
+}
+
+// CourierRegistry maps courier codes to the tracker that serves them and caches
+// results per tracking number
+type CourierRegistry struct {
+	cacheTTL time.Duration
+
+	mu       sync.RWMutex
+	couriers map[string]Courier
+	trackers map[string]CourierTracker
+	cache    map[string]trackingCacheEntry
+}
+
+// NewCourierRegistry returns an empty registry whose results are cached for cacheTTL
+func NewCourierRegistry(cacheTTL time.Duration) *CourierRegistry {
+	return &CourierRegistry{
+		cacheTTL: cacheTTL,
+		couriers: make(map[string]Courier),
+		trackers: make(map[string]CourierTracker),
+		cache:    make(map[string]trackingCacheEntry),
+	}
+}
+
+// NewCourierRegistryFromConfig registers the aggregator tracker for every supported
+// courier when it is configured, and the mock courier outside production
+func NewCourierRegistryFromConfig(cfg *config.Config) *CourierRegistry {
+	registry := NewCourierRegistry(cfg.TrackingCacheTTL)
+
+	if cfg.TrackingAPIURL != "" {
+		aggregator := NewAggregatorTracker(cfg.TrackingAPIURL, cfg.TrackingAPIKey)
+		for _, courier := range SupportedCouriers {
+			registry.Register(courier, aggregator)
+		}
+	}
+
+	if cfg.Env != "production" {
+		registry.Register(Courier{Code: CourierMock, Name: "Mock Courier"}, MockTracker{})
+	}
+
+	return registry
+}
+
+// Register makes a courier trackable with the given tracker
+func (r *CourierRegistry) Register(courier Courier, tracker CourierTracker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	courier.Code = strings.ToLower(courier.Code)
+	r.couriers[courier.Code] = courier
+	r.trackers[courier.Code] = tracker
+}
+
+// Couriers returns the trackable couriers sorted by name
+func (r *CourierRegistry) Couriers() []Courier {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	couriers := make([]Courier, 0, len(r.couriers))
+	for _, courier := range r.couriers {
+		couriers = append(couriers, courier)
+	}
+	sort.Slice(couriers, func(i, j int) bool { return couriers[i].Name < couriers[j].Name })
+	return couriers
+}
+
+// Lookup returns the courier registered under code
+func (r *CourierRegistry) Lookup(code string) (Courier, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	courier, ok := r.couriers[strings.ToLower(code)]
+	return courier, ok
+}
+
+// Track returns the shipment state, from the cache while it is fresh
+func (r *CourierRegistry) Track(ctx context.Context, code, trackingNumber string) (*Shipment, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	trackingNumber = strings.TrimSpace(trackingNumber)
+	key := code + ":" + trackingNumber
+
+	r.mu.RLock()
+	courier, ok := r.couriers[code]
+	tracker := r.trackers[code]
+	entry, cached := r.cache[key]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCourier, code)
+	}
+	if cached && time.Now().Before(entry.expires) {
+		return entry.shipment, nil
+	}
+
+	shipment, err := tracker.Track(ctx, courier, trackingNumber)
+	if err != nil {
+		return nil, err
+	}
+	shipment.Courier = courier.Code
+	shipment.CourierName = courier.Name
+	shipment.FetchedAt = time.Now()
+
+	r.mu.Lock()
+	r.cache[key] = trackingCacheEntry{shipment: shipment, expires: shipment.FetchedAt.Add(r.cacheTTL)}
+	r.pruneCacheLocked()
+	r.mu.Unlock()
+
+	return shipment, nil
+}
+
+// pruneCacheLocked drops expired entries so the cache does not grow without bound
+func (r *CourierRegistry) pruneCacheLocked() {
+	now := time.Now()
+	for key, entry := range r.cache {
+		if now.After(entry.expires) {
+			delete(r.cache, key)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// AggregatorTracker tracks shipments through a multi-courier tracking API that
+// follows the common Indonesian aggregator format (BinderByte and compatible):
+//
+//	GET {BaseURL}/v1/track?api_key=...&courier=jne&awb=...
+type AggregatorTracker struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+// NewAggregatorTracker returns a tracker for the aggregator API at baseURL
+func NewAggregatorTracker(baseURL, apiKey string) *AggregatorTracker {
+	return &AggregatorTracker{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		APIKey:  apiKey,
+		Client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type aggregatorResponse struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		Summary struct {
+			AWB     string `json:"awb"`
+			Courier string `json:"courier"`
+			Status  string `json:"status"`
+			Date    string `json:"date"`
+		} `json:"summary"`
+		History []struct {
+			Date     string `json:"date"`
+			Desc     string `json:"desc"`
+			Location string `json:"location"`
+		} `json:"history"`
+	} `json:"data"`
+}
+
+// aggregatorTimeLayout is the timestamp format used by the aggregator, in WIB
+const aggregatorTimeLayout = "2006-01-02 15:04:05"
+
+var wib = time.FixedZone("WIB", 7*60*60)
+
+// Track fetches a shipment from the aggregator
+func (a *AggregatorTracker) Track(ctx context.Context, courier Courier, trackingNumber string) (*Shipment, error) {
+	query := url.Values{}
+	query.Set("api_key", a.APIKey)
+	query.Set("courier", courier.Code)
+	query.Set("awb", trackingNumber)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.BaseURL+"/v1/track?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tracking: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("tracking: %w", err)
+	}
+
+	var result aggregatorResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("tracking: failed to parse response (HTTP %d): %w", resp.StatusCode, err)
+	}
+
+	switch {
+	case result.Status == http.StatusNotFound || resp.StatusCode == http.StatusNotFound:
+		return nil, ErrShipmentNotFound
+	case result.Status != http.StatusOK:
+		return nil, fmt.Errorf("tracking: aggregator returned %d: %s", result.Status, result.Message)
+	}
+
+	shipment := &Shipment{
+		TrackingNumber: trackingNumber,
+		Status:         normalizeTrackingStatus(result.Data.Summary.Status),
+	}
+
+	// The aggregator lists history newest first
+	for i := len(result.Data.History) - 1; i >= 0; i-- {
+		entry := result.Data.History[i]
+		eventTime, _ := time.ParseInLocation(aggregatorTimeLayout, entry.Date, wib)
+		shipment.Events = append(shipment.Events, TrackingEvent{
+			Time:        eventTime,
+			Status:      normalizeTrackingStatus(entry.Desc),
+			Description: entry.Desc,
+			Location:    entry.Location,
+		})
+	}
+
+	if shipment.Status == TrackingStatusDelivered && len(shipment.Events) > 0 {
+		deliveredAt := shipment.Events[len(shipment.Events)-1].Time
+		shipment.DeliveredAt = &deliveredAt
+	}
+
+	return shipment, nil
+}
+
+// failedDeliveryWords mark a status as a failed or negated delivery, which
+// must never read as delivered ("UNDELIVERED", "NOT DELIVERED", "BELUM DITERIMA")
+var failedDeliveryWords = []string{"UNDELIVER", "NOT DELIVERED", "FAIL", "GAGAL", "BELUM DITERIMA", "TIDAK DITERIMA", "TIDAK BERHASIL"}
+
+// normalizeTrackingStatus maps courier status wording to a normalized status
+func normalizeTrackingStatus(raw string) string {
+	status := strings.ToUpper(raw)
+	words := strings.FieldsFunc(status, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	switch {
+	case strings.Contains(status, "RETURN"), strings.Contains(status, "RETUR"):
+		return TrackingStatusReturned
+	case containsAny(status, failedDeliveryWords):
+		return TrackingStatusDeliveryFailed
+	case hasWord(words, "DELIVERED"), hasWord(words, "DITERIMA"):
+		return TrackingStatusDelivered
+	case strings.Contains(status, "WITH DELIVERY COURIER"), strings.Contains(status, "OUT FOR DELIVERY"),
+		strings.Contains(status, "DIANTAR"):
+		return TrackingStatusOutForDelivery
+	case strings.Contains(status, "TRANSIT"), strings.Contains(status, "ON PROCESS"), strings.Contains(status, "PERJALANAN"),
+		strings.Contains(status, "SAMPAI"), strings.Contains(status, "DEPARTED"), strings.Contains(status, "ARRIVED"):
+		return TrackingStatusInTransit
+	case strings.Contains(status, "MANIFEST"), strings.Contains(status, "PICK"), strings.Contains(status, "DIAMBIL"),
+		strings.Contains(status, "PROCESS"):
+		return TrackingStatusProcessing
+	default:
+		return TrackingStatusUnknown
+	}
+}
+
+// containsAny reports whether s contains any of the substrings
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWord reports whether word is one of words
+func hasWord(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
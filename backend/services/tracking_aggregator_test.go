@@ -0,0 +1,25 @@
+package services
+
+import "testing"
+
+func TestNormalizeTrackingStatus(t *testing.T) {
+	tests := map[string]string{
+		"DELIVERED":                       TrackingStatusDelivered,
+		"Paket telah diterima oleh BUDI":  TrackingStatusDelivered,
+		"UNDELIVERED":                     TrackingStatusDeliveryFailed,
+		"NOT DELIVERED - ADDRESS UNKNOWN": TrackingStatusDeliveryFailed,
+		"DELIVERY FAILED":                 TrackingStatusDeliveryFailed,
+		"Paket gagal diantar":             TrackingStatusDeliveryFailed,
+		"Paket belum diterima":            TrackingStatusDeliveryFailed,
+		"RETURNED TO SENDER":              TrackingStatusReturned,
+		"WITH DELIVERY COURIER":           TrackingStatusOutForDelivery,
+		"ON TRANSIT":                      TrackingStatusInTransit,
+		"MANIFESTED":                      TrackingStatusProcessing,
+		"":                                TrackingStatusUnknown,
+	}
+	for raw, want := range tests {
+		if got := normalizeTrackingStatus(raw); got != want {
+			t.Errorf("normalizeTrackingStatus(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Webhook event types integrators can subscribe to
+const (
+	WebhookOrderCreated        = "order.created"
+	WebhookOrderPaid           = "order.paid"
+	WebhookOrderStatusChanged  = "order.status_changed"
+	WebhookOrderCancelled      = "order.cancelled"
+	WebhookProductCreated      = "product.created"
+	WebhookProductUpdated      = "product.updated"
+	WebhookProductStockChanged = "product.stock_changed"
+)
+
+// WebhookEventTypes lists every webhook event type
+var WebhookEventTypes = []string{
+	WebhookOrderCreated,
+	WebhookOrderPaid,
+	WebhookOrderStatusChanged,
+	WebhookOrderCancelled,
+	WebhookProductCreated,
+	WebhookProductUpdated,
+	WebhookProductStockChanged,
+}
+
+// webhookEvents maps the domain events integrators hear about to their webhook event type
+var webhookEvents = map[string]string{
+	EventOrderPlaced:        WebhookOrderCreated,
+	EventOrderPaid:          WebhookOrderPaid,
+	EventOrderStatusChanged: WebhookOrderStatusChanged,
+	EventOrderCancelled:     WebhookOrderCancelled,
+	EventProductCreated:     WebhookProductCreated,
+	EventProductUpdated:     WebhookProductUpdated,
+	EventStockChanged:       WebhookProductStockChanged,
+}
+
+// Headers sent with every webhook request
+const (
+	WebhookHeaderEvent     = "X-Nexora-Event"
+	WebhookHeaderDelivery  = "X-Nexora-Delivery"
+	WebhookHeaderTimestamp = "X-Nexora-Timestamp"
+	WebhookHeaderSignature = "X-Nexora-Signature"
+)
+
+// Webhook retry policy
+const (
+	webhookMaxAttempts  = 8
+	webhookBaseBackoff  = 30 * time.Second
+	webhookMaxBackoff   = 6 * time.Hour
+	webhookSendLease    = 2 * time.Minute
+	webhookResponseKeep = 1024 // bytes of the response body kept in the log
+)
+
+// IsWebhookEventType reports whether t is a webhook event type
+func IsWebhookEventType(t string) bool {
+	for _, known := range WebhookEventTypes {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWebhookSecret returns a random signing secret for a subscription
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// SignWebhook returns the signature of a webhook body: the hex HMAC-SHA256,
+// keyed with the subscription secret, of "<timestamp>.<body>". Receivers
+// recompute it and should reject old timestamps to stop replays.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookEnvelope is the JSON body of every webhook request
+type WebhookEnvelope struct {
+	ID        uuid.UUID       `json:"id"` // the event; the same for every subscription and retry
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// queueWebhookDeliveries is the event subscriber that queues a delivery of an
+// event for every active subscription to it. A repeated event queues nothing
+// new, since deliveries are unique per subscription and event.
+func queueWebhookDeliveries(ctx context.Context, db *gorm.DB, event Event) error {
+	webhookType := webhookEvents[event.Type]
+
+	var subscriptions []models.WebhookSubscription
+	if err := db.Where("is_active = ?", true).Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(WebhookEnvelope{
+		ID:        event.ID,
+		Type:      webhookType,
+		CreatedAt: event.CreatedAt,
+		Data:      event.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		if !subscribedTo(subscription, webhookType) {
+			continue
+		}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      webhookType,
+			Payload:        string(body),
+			Status:         models.WebhookDeliveryPending,
+			NextAttemptAt:  time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribedTo reports whether a subscription wants a webhook event type
+func subscribedTo(subscription models.WebhookSubscription, webhookType string) bool {
+	for _, t := range subscription.Events {
+		if t == webhookType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSender posts webhook deliveries to their subscriptions
+type WebhookSender struct {
+	Client *http.Client
+}
+
+// NewWebhookSender returns a sender with a request timeout
+func NewWebhookSender() *WebhookSender {
+	return &WebhookSender{Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// SendPending sends up to limit due deliveries. Deliveries are claimed like
+// queued emails, so concurrent senders never post the same delivery at once.
+// It returns how many succeeded.
+func (s *WebhookSender) SendPending(ctx context.Context, db *gorm.DB, limit int) (int, error) {
+	var deliveries []models.WebhookDelivery
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+			Order("next_attempt_at").Limit(limit).Find(&deliveries).Error; err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(deliveries))
+		for i := range deliveries {
+			ids[i] = deliveries[i].ID
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(webhookSendLease)).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	succeeded := 0
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			return succeeded, ctx.Err()
+		}
+		if err := s.Deliver(ctx, db, &deliveries[i]); err != nil {
+			return succeeded, err
+		}
+		if deliveries[i].Status == models.WebhookDeliverySucceeded {
+			succeeded++
+		}
+	}
+	return succeeded, nil
+}
+
+// Deliver makes one attempt at a delivery, logs it and stores the outcome:
+// succeeded on a 2xx response, otherwise a retry with backoff until the last
+// attempt fails it. The returned error is only about storing the outcome.
+func (s *WebhookSender) Deliver(ctx context.Context, db *gorm.DB, delivery *models.WebhookDelivery) error {
+	var subscription models.WebhookSubscription
+	result := db.Limit(1).Find(&subscription, "id = ?", delivery.SubscriptionID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	delivery.Attempts++
+	attempt := models.WebhookDeliveryAttempt{DeliveryID: delivery.ID}
+	switch {
+	case result.RowsAffected == 0:
+		attempt.Error = "subscription was deleted"
+	case !subscription.IsActive:
+		attempt.Error = "subscription is disabled"
+	default:
+		s.post(ctx, subscription, delivery, &attempt)
+	}
+
+	now := time.Now()
+	delivery.ResponseStatus = attempt.ResponseStatus
+	delivery.LastError = attempt.Error
+	switch {
+	case attempt.Error == "":
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= webhookMaxAttempts || result.RowsAffected == 0 || !subscription.IsActive:
+		delivery.Status = models.WebhookDeliveryFailed
+		log.Printf("Giving up on webhook delivery %s of %s to %s: %s", delivery.ID, delivery.EventType, subscription.URL, attempt.Error)
+	default:
+		delivery.Status = models.WebhookDeliveryPending
+		delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts, webhookBaseBackoff, webhookMaxBackoff))
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+			"status":          delivery.Status,
+			"attempts":        delivery.Attempts,
+			"next_attempt_at": delivery.NextAttemptAt,
+			"response_status": delivery.ResponseStatus,
+			"last_error":      delivery.LastError,
+			"delivered_at":    delivery.DeliveredAt,
+		}).Error
+	})
+}
+
+// post sends a delivery's signed payload, recording the response in attempt
+func (s *WebhookSender) post(ctx context.Context, subscription models.WebhookSubscription, delivery *models.WebhookDelivery, attempt *models.WebhookDeliveryAttempt) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Nexora-Webhooks/1.0")
+	req.Header.Set(WebhookHeaderEvent, delivery.EventType)
+	req.Header.Set(WebhookHeaderDelivery, delivery.ID.String())
+	req.Header.Set(WebhookHeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookHeaderSignature, SignWebhook(subscription.Secret, timestamp, body))
+
+	start := time.Now()
+	resp, err := s.Client.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseKeep))
+	attempt.ResponseStatus = resp.StatusCode
+	attempt.ResponseBody = string(respBody)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("receiver answered %d", resp.StatusCode)
+	}
+}
+
+// Redeliver starts a delivery over and makes its first attempt right away
+func (s *WebhookSender) Redeliver(ctx context.Context, db *gorm.DB, delivery *models.WebhookDelivery) error {
+	delivery.Attempts = 0
+	delivery.Status = models.WebhookDeliveryPending
+	return s.Deliver(ctx, db, delivery)
+}
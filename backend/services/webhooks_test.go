@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"nexora-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// TestWebhookDeliveryRetry posts a delivery to a receiver that fails once:
+// every request is signed, the failure is logged and retried with backoff,
+// and the retry succeeds
+func TestWebhookDeliveryRetry(t *testing.T) {
+	db := testDB(t)
+	if err := db.AutoMigrate(&models.WebhookSubscription{}, &models.WebhookDelivery{}, &models.WebhookDeliveryAttempt{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	const secret = "test-secret"
+	var mu sync.Mutex
+	requests := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(WebhookHeaderTimestamp), 10, 64)
+		if err != nil {
+			t.Errorf("timestamp header %q: %v", r.Header.Get(WebhookHeaderTimestamp), err)
+		}
+		if got, want := r.Header.Get(WebhookHeaderSignature), SignWebhook(secret, timestamp, body); got != want {
+			t.Errorf("signature header = %q, want %q", got, want)
+		}
+
+		mu.Lock()
+		requests++
+		first := requests == 1
+		mu.Unlock()
+		if first {
+			http.Error(w, "try again", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	subscription := models.WebhookSubscription{URL: receiver.URL, Secret: secret, Events: []string{WebhookOrderCreated}, IsActive: true}
+	if err := db.Create(&subscription).Error; err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	delivery := models.WebhookDelivery{
+		SubscriptionID: subscription.ID,
+		EventID:        uuid.New(),
+		EventType:      WebhookOrderCreated,
+		Payload:        `{"type":"order.created"}`,
+		Status:         models.WebhookDeliveryPending,
+		NextAttemptAt:  time.Now(),
+	}
+	if err := db.Create(&delivery).Error; err != nil {
+		t.Fatalf("create delivery: %v", err)
+	}
+
+	sender := NewWebhookSender()
+	started := time.Now()
+	if succeeded, err := sender.SendPending(context.Background(), db, 10); err != nil || succeeded != 0 {
+		t.Fatalf("first run: succeeded %d, err %v; want 0, nil", succeeded, err)
+	}
+
+	if err := db.First(&delivery, "id = ?", delivery.ID).Error; err != nil {
+		t.Fatalf("reload delivery: %v", err)
+	}
+	if delivery.Status != models.WebhookDeliveryPending || delivery.Attempts != 1 || delivery.ResponseStatus != http.StatusInternalServerError {
+		t.Errorf("after a 500: status %s, attempts %d, response %d; want pending, 1, 500",
+			delivery.Status, delivery.Attempts, delivery.ResponseStatus)
+	}
+	if retryAt := started.Add(webhookBaseBackoff); delivery.NextAttemptAt.Before(retryAt) {
+		t.Errorf("retry scheduled at %s, want no earlier than %s", delivery.NextAttemptAt, retryAt)
+	}
+
+	// The retry is due
+	if err := sender.Deliver(context.Background(), db, &delivery); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if delivery.Status != models.WebhookDeliverySucceeded || delivery.ResponseStatus != http.StatusOK {
+		t.Errorf("after retry: status %s, response %d; want succeeded, 200", delivery.Status, delivery.ResponseStatus)
+	}
+
+	var attempts []models.WebhookDeliveryAttempt
+	if err := db.Where("delivery_id = ?", delivery.ID).Order("created_at").Find(&attempts).Error; err != nil {
+		t.Fatalf("load delivery log: %v", err)
+	}
+	if len(attempts) != 2 || attempts[0].ResponseStatus != http.StatusInternalServerError || attempts[1].ResponseStatus != http.StatusOK {
+		t.Fatalf("delivery log = %+v, want a 500 then a 200", attempts)
+	}
+	if attempts[0].Error == "" || attempts[1].Error != "" {
+		t.Errorf("delivery log errors = %q, %q; want the 500 only", attempts[0].Error, attempts[1].Error)
+	}
+}
@@ -0,0 +1,38 @@
+'use client';
+
+import { useEffect } from 'react';
+import { useSearchParams, useRouter } from 'next/navigation';
+import { Loader2 } from 'lucide-react';
+import { api } from '@/lib/api';
+import { useCart } from '@/lib/context';
+
+export default function CartRecoverPage() {
+    const searchParams = useSearchParams();
+    const router = useRouter();
+    const { refreshCart } = useCart();
+
+    useEffect(() => {
+        const id = searchParams.get('id');
+        const sig = searchParams.get('sig');
+
+        if (!id || !sig) {
+            router.push('/cart');
+            return;
+        }
+
+        api.recoverCart(id, sig)
+            .catch(() => undefined)
+            .then(() => refreshCart())
+            .finally(() => router.push('/cart'));
+    }, [searchParams, router, refreshCart]);
+
+    return (
+        <div className="min-h-screen flex items-center justify-center">
+            <div className="text-center">
+                <Loader2 className="w-12 h-12 text-primary animate-spin mx-auto mb-4" />
+                <h2 className="text-xl font-semibold text-white mb-2">Restoring your cart...</h2>
+                <p className="text-slate-400">Please wait a moment</p>
+            </div>
+        </div>
+    );
+}
@@ -4,7 +4,7 @@ import { useState, useEffect } from 'react';
 import { useRouter } from 'next/navigation';
 import Image from 'next/image';
 import { Plus, MapPin, CreditCard, Loader2, User, Mail, Phone, Home } from 'lucide-react';
-import { api, Address } from '@/lib/api';
+import { api, Address, ShippingQuote } from '@/lib/api';
 import { useAuth, useCart } from '@/lib/context';
 import { Button } from '@/components/ui/Button';
 import { formatPrice, cn } from '@/lib/utils';
@@ -56,9 +56,40 @@ export default function CheckoutPage() {
         ? (cart?.subtotal || 0)
         : guestCart.reduce((sum, item) => sum + (item.product?.base_price || 0) * item.quantity, 0);
 
-    const shippingFee = subtotal > 500000 ? 0 : 15000;
+    // Shipping quotes from the server rate tables
+    const [shippingQuotes, setShippingQuotes] = useState<ShippingQuote[]>([]);
+    const [selectedCourier, setSelectedCourier] = useState<string>('');
+    const selectedQuote = shippingQuotes.find((q) => q.courier === selectedCourier) || shippingQuotes[0];
+
+    const shippingFee = selectedQuote?.fee || 0;
     const total = subtotal + shippingFee;
 
+    useEffect(() => {
+        if (items.length === 0 || (isAuthenticated && !selectedAddressId)) return;
+
+        const fetchQuotes = async () => {
+            try {
+                const data = await api.quoteShipping(
+                    isAuthenticated
+                        ? { address_id: selectedAddressId }
+                        : {
+                            items: guestCart.map((item) => ({
+                                product_id: item.productId,
+                                quantity: item.quantity,
+                            })),
+                        }
+                );
+                setShippingQuotes(data.quotes);
+            } catch (error) {
+                console.error('Failed to quote shipping:', error);
+                setShippingQuotes([]);
+            }
+        };
+
+        fetchQuotes();
+        // eslint-disable-next-line react-hooks/exhaustive-deps
+    }, [isAuthenticated, selectedAddressId, items.length, subtotal]);
+
     // Load Midtrans Snap script
     useEffect(() => {
         const clientKey = process.env.NEXT_PUBLIC_MIDTRANS_CLIENT_KEY;
@@ -136,7 +167,7 @@ export default function CheckoutPage() {
 
             setIsCreatingOrder(true);
             try {
-                const order = await api.createOrder(selectedAddressId, notes);
+                const order = await api.createOrder(selectedAddressId, notes, undefined, selectedQuote?.courier);
                 console.log('Order created:', order);
 
                 const payment = await api.createPayment(order.id);
@@ -144,14 +175,15 @@ export default function CheckoutPage() {
 
                 await refreshCart();
 
-                if (payment.snap_token && (window as any).snap) {
+                if (payment.provider !== 'fake' && payment.snap_token && (window as any).snap) {
                     (window as any).snap.pay(payment.snap_token, {
                         onSuccess: async function (result: any) {
                             console.log('Payment success:', result);
                             try {
-                                await api.simulatePayment(order.id);
+                                // Refreshes the payment from the gateway in case the webhook can't reach us
+                                await api.getPaymentStatus(order.id);
                             } catch (e) {
-                                console.log('Simulate done or error:', e);
+                                console.log('Payment status refresh failed:', e);
                             }
                             router.push(`/orders/${order.id}`);
                         },
@@ -195,6 +227,7 @@ export default function CheckoutPage() {
                     guest_phone: guestInfo.phone,
                     guest_address: guestInfo.address,
                     notes: notes,
+                    courier: selectedQuote?.courier,
                     items: guestCart.map(item => ({
                         product_id: item.productId,
                         quantity: item.quantity,
@@ -212,7 +245,7 @@ export default function CheckoutPage() {
                 await clearCart();
 
                 // Open Midtrans Snap popup
-                if (payment.snap_token && (window as any).snap) {
+                if (payment.provider !== 'fake' && payment.snap_token && (window as any).snap) {
                     (window as any).snap.pay(payment.snap_token, {
                         onSuccess: function (result: any) {
                             console.log('Guest payment success:', result);
@@ -530,6 +563,19 @@ export default function CheckoutPage() {
                                     <span>Subtotal</span>
                                     <span className="text-white">{formatPrice(subtotal)}</span>
                                 </div>
+                                {shippingQuotes.length > 0 && (
+                                    <select
+                                        value={selectedQuote?.courier}
+                                        onChange={(e) => setSelectedCourier(e.target.value)}
+                                        className="input w-full"
+                                    >
+                                        {shippingQuotes.map((quote) => (
+                                            <option key={quote.courier} value={quote.courier}>
+                                                {quote.courier_name} - {quote.free_shipping ? 'Free' : formatPrice(quote.fee)}
+                                            </option>
+                                        ))}
+                                    </select>
+                                )}
                                 <div className="flex items-center justify-between text-slate-400">
                                     <span>Shipping</span>
                                     <span className="text-white">
@@ -99,17 +99,23 @@ export default function OrderDetailPage() {
             const response = await api.createPayment(orderId);
             console.log('Payment response:', response);
 
+            if (response.provider === 'fake') {
+                // Local fake gateway: its pay page settles the payment and redirects back
+                window.location.href = response.redirect_url;
+                return;
+            }
+
             if (response.snap_token) {
                 // Trigger Snap Popup
                 window.snap.pay(response.snap_token, {
                     onSuccess: async function (result: any) {
                         console.log('Payment success:', result);
-                        // For localhost: simulate payment to update backend
+                        // Refresh the payment from the gateway
                         // (Midtrans webhook can't reach localhost)
                         try {
-                            await api.simulatePayment(orderId);
+                            await api.getPaymentStatus(orderId);
                         } catch (e) {
-                            console.log('Simulate already done or error:', e);
+                            console.log('Payment status refresh failed:', e);
                         }
                         window.location.reload();
                     },
@@ -3,7 +3,7 @@
 import { useState, useEffect } from 'react';
 import { useSearchParams } from 'next/navigation';
 import { Search, SlidersHorizontal, X } from 'lucide-react';
-import { api, Product, Category } from '@/lib/api';
+import { api, Product, Category, ProductSort } from '@/lib/api';
 import { ProductCard, ProductCardSkeleton } from '@/components/product/ProductCard';
 import { Button } from '@/components/ui/Button';
 import { cn } from '@/lib/utils';
@@ -19,8 +19,9 @@ export default function ProductsPage() {
     // Filter state
     const [search, setSearch] = useState(searchParams.get('search') || '');
     const [category, setCategory] = useState(searchParams.get('category') || '');
-    const [sort, setSort] = useState(searchParams.get('sort') || 'created_at');
-    const [order, setOrder] = useState<'asc' | 'desc'>((searchParams.get('order') as 'asc' | 'desc') || 'desc');
+    const [sort, setSort] = useState<ProductSort>((searchParams.get('sort') as ProductSort) || 'newest');
+    // Empty uses the sort key's own direction
+    const [order, setOrder] = useState<'' | 'asc' | 'desc'>((searchParams.get('order') as 'asc' | 'desc') || '');
     const [page, setPage] = useState(1);
     const [minPrice, setMinPrice] = useState('');
     const [maxPrice, setMaxPrice] = useState('');
@@ -45,7 +46,7 @@ export default function ProductsPage() {
                     search: search || undefined,
                     category: category || undefined,
                     sort,
-                    order,
+                    order: order || undefined,
                     page,
                     limit: 12,
                     featured: searchParams.get('featured') === 'true' || undefined,
@@ -67,14 +68,14 @@ export default function ProductsPage() {
     const clearFilters = () => {
         setSearch('');
         setCategory('');
-        setSort('created_at');
-        setOrder('desc');
+        setSort('newest');
+        setOrder('');
         setMinPrice('');
         setMaxPrice('');
         setPage(1);
     };
 
-    const hasActiveFilters = search || category || sort !== 'created_at' || order !== 'desc' || minPrice || maxPrice;
+    const hasActiveFilters = search || category || sort !== 'newest' || order !== '' || minPrice || maxPrice;
 
     return (
         <div className="min-h-screen py-8">
@@ -111,17 +112,19 @@ export default function ProductsPage() {
                         value={`${sort}-${order}`}
                         onChange={(e) => {
                             const [newSort, newOrder] = e.target.value.split('-');
-                            setSort(newSort);
-                            setOrder(newOrder as 'asc' | 'desc');
+                            setSort(newSort as ProductSort);
+                            setOrder(newOrder as '' | 'asc' | 'desc');
                             setPage(1);
                         }}
                         className="input w-full lg:w-48"
                     >
-                        <option value="created_at-desc">Newest First</option>
-                        <option value="created_at-asc">Oldest First</option>
-                        <option value="base_price-asc">Price: Low to High</option>
-                        <option value="base_price-desc">Price: High to Low</option>
-                        <option value="name-asc">Name: A-Z</option>
+                        <option value="newest-">Newest First</option>
+                        <option value="newest-asc">Oldest First</option>
+                        <option value="price_asc-">Price: Low to High</option>
+                        <option value="price_desc-">Price: High to Low</option>
+                        <option value="best_selling-">Best Selling</option>
+                        <option value="top_rated-">Top Rated</option>
+                        <option value="name-">Name: A-Z</option>
                         <option value="name-desc">Name: Z-A</option>
                     </select>
 
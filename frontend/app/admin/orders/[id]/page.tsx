@@ -18,7 +18,7 @@ import {
     Mail,
     Loader2
 } from 'lucide-react';
-import { api, Order } from '@/lib/api';
+import { api, Order, Courier } from '@/lib/api';
 import { Button } from '@/components/ui/Button';
 import { formatPrice, formatDateTime, cn } from '@/lib/utils';
 
@@ -40,6 +40,8 @@ export default function AdminOrderDetailPage() {
     const [isLoading, setIsLoading] = useState(true);
     const [isUpdating, setIsUpdating] = useState(false);
     const [trackingNumber, setTrackingNumber] = useState('');
+    const [courier, setCourier] = useState('');
+    const [couriers, setCouriers] = useState<Courier[]>([]);
     const [showShippingForm, setShowShippingForm] = useState(false);
 
     useEffect(() => {
@@ -48,6 +50,7 @@ export default function AdminOrderDetailPage() {
                 const data = await api.adminGetOrderDetail(orderId);
                 setOrder(data);
                 setTrackingNumber(data.tracking_number || '');
+                setCourier(data.courier || '');
             } catch (error) {
                 console.error('Failed to fetch order:', error);
             } finally {
@@ -55,13 +58,16 @@ export default function AdminOrderDetailPage() {
             }
         };
         fetchOrder();
+        api.getCouriers()
+            .then((data) => setCouriers(data.couriers))
+            .catch((error) => console.error('Failed to fetch couriers:', error));
     }, [orderId]);
 
-    const updateStatus = async (status: string, tracking?: string) => {
+    const updateStatus = async (status: string, tracking?: string, courierCode?: string) => {
         if (!order) return;
         setIsUpdating(true);
         try {
-            await api.adminUpdateOrderStatus(orderId, status, tracking);
+            await api.adminUpdateOrderStatus(orderId, status, tracking, courierCode);
             const updated = await api.adminGetOrderDetail(orderId);
             setOrder(updated);
             setShowShippingForm(false);
@@ -171,11 +177,29 @@ export default function AdminOrderDetailPage() {
                                         <p className="text-red-400 text-sm mt-1">Tracking number is required to ship order</p>
                                     )}
                                 </div>
+                                <div>
+                                    <label className="block text-sm text-slate-400 mb-2">
+                                        Courier <span className="text-red-500">*</span>
+                                    </label>
+                                    <select
+                                        value={courier}
+                                        onChange={(e) => setCourier(e.target.value)}
+                                        className="input w-full"
+                                    >
+                                        <option value="">Select courier</option>
+                                        {couriers.map((c) => (
+                                            <option key={c.code} value={c.code}>{c.name}</option>
+                                        ))}
+                                        {courier && !couriers.some((c) => c.code === courier) && (
+                                            <option value={courier}>{courier.toUpperCase()}</option>
+                                        )}
+                                    </select>
+                                </div>
                                 <div className="flex gap-3">
                                     <Button
-                                        onClick={() => updateStatus('shipped', trackingNumber)}
+                                        onClick={() => updateStatus('shipped', trackingNumber, courier)}
                                         isLoading={isUpdating}
-                                        disabled={!trackingNumber.trim()}
+                                        disabled={!trackingNumber.trim() || !courier}
                                     >
                                         <Truck className="w-4 h-4" />
                                         Mark as Shipped
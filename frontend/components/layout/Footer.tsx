@@ -8,7 +8,7 @@ export function Footer() {
             { href: '/products', label: 'All Products' },
             { href: '/categories', label: 'Categories' },
             { href: '/products?featured=true', label: 'Featured' },
-            { href: '/products?sort=created_at&order=desc', label: 'New Arrivals' },
+            { href: '/products?sort=newest', label: 'New Arrivals' },
         ],
         account: [
             { href: '/account', label: 'My Account' },
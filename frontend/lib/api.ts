@@ -18,6 +18,13 @@ class ApiClient {
         return null;
     }
 
+    private getCartToken(): string | null {
+        if (typeof window !== 'undefined') {
+            return localStorage.getItem('cart_token');
+        }
+        return null;
+    }
+
     private async request<T>(endpoint: string, options: FetchOptions = {}): Promise<T> {
         const { token, ...fetchOptions } = options;
         const authToken = token || this.getToken();
@@ -31,11 +38,22 @@ class ApiClient {
             (headers as Record<string, string>)['Authorization'] = `Bearer ${authToken}`;
         }
 
+        // Guest carts live on the server under an opaque token
+        const cartToken = this.getCartToken();
+        if (cartToken) {
+            (headers as Record<string, string>)['X-Cart-Token'] = cartToken;
+        }
+
         const response = await fetch(`${this.baseUrl}${endpoint}`, {
             ...fetchOptions,
             headers,
         });
 
+        const issuedCartToken = response.headers.get('X-Cart-Token');
+        if (issuedCartToken && typeof window !== 'undefined') {
+            localStorage.setItem('cart_token', issuedCartToken);
+        }
+
         if (!response.ok) {
             const error = await response.json().catch(() => ({ error: 'An error occurred' }));
             throw new Error(error.error || `HTTP error! status: ${response.status}`);
@@ -50,17 +68,27 @@ class ApiClient {
     }
 
     async register(name: string, email: string, password: string) {
-        return this.request<{ token: string; user: User }>('/auth/register', {
+        const result = await this.request<{ token: string; user: User }>('/auth/register', {
             method: 'POST',
             body: JSON.stringify({ name, email, password }),
         });
+        // The server merged the guest cart into the account
+        if (typeof window !== 'undefined') {
+            localStorage.removeItem('cart_token');
+        }
+        return result;
     }
 
     async login(email: string, password: string) {
-        return this.request<{ token: string; user: User }>('/auth/login', {
+        const result = await this.request<{ token: string; user: User }>('/auth/login', {
             method: 'POST',
             body: JSON.stringify({ email, password }),
         });
+        // The server merged the guest cart into the account
+        if (typeof window !== 'undefined') {
+            localStorage.removeItem('cart_token');
+        }
+        return result;
     }
 
     async getMe() {
@@ -72,6 +100,14 @@ class ApiClient {
         const searchParams = new URLSearchParams();
         if (params?.search) searchParams.set('search', params.search);
         if (params?.category) searchParams.set('category', params.category);
+        if (params?.categories?.length) searchParams.set('category', params.categories.join(','));
+        Object.entries(params?.attributes ?? {}).forEach(([name, values]) => {
+            if (values.length) searchParams.set(`attr[${name}]`, values.join(','));
+        });
+        if (params?.inStock) searchParams.set('in_stock', 'true');
+        if (params?.minRating) searchParams.set('min_rating', params.minRating.toString());
+        if (params?.facets === false) searchParams.set('facets', 'false');
+        if (params?.cursor !== undefined) searchParams.set('cursor', params.cursor);
         if (params?.featured) searchParams.set('featured', 'true');
         if (params?.page) searchParams.set('page', params.page.toString());
         if (params?.limit) searchParams.set('limit', params.limit.toString());
@@ -124,6 +160,32 @@ class ApiClient {
         });
     }
 
+    // Accepts the current prices of the cart, clearing its price change warnings
+    async acceptCartPrices() {
+        return this.request<{ items: CartItem[] }>('/cart/accept-prices', {
+            method: 'POST',
+        });
+    }
+
+        // Puts the items of an abandoned cart email back into the cart
+    async recoverCart(id: string, sig: string) {
+        return this.request<{ restored: number }>('/cart/recover', {
+            method: 'POST',
+            body: JSON.stringify({ id, sig }),
+        });
+    }
+
+    // Moves the guest cart into the signed in user's cart (login and register do this too)
+    async mergeCart() {
+        const result = await this.request<{ merged: number }>('/cart/merge', {
+            method: 'POST',
+        });
+        if (typeof window !== 'undefined') {
+            localStorage.removeItem('cart_token');
+        }
+        return result;
+    }
+
     // Wishlist
     async getWishlist() {
         return this.request<WishlistItem[]>('/wishlist');
@@ -143,15 +205,16 @@ class ApiClient {
     }
 
     // Orders
-    async getOrders(page?: number) {
-        const query = page ? `?page=${page}` : '';
+    // Pass a cursor ('' for the first page) to page by cursor instead of page number
+    async getOrders(page?: number, cursor?: string) {
+        const query = cursor !== undefined ? `?cursor=${encodeURIComponent(cursor)}` : page ? `?page=${page}` : '';
         return this.request<OrdersResponse>(`/orders${query}`);
     }
 
-    async createOrder(addressId: string, notes?: string) {
+    async createOrder(addressId: string, notes?: string, couponCode?: string, courier?: string) {
         return this.request<Order>('/orders', {
             method: 'POST',
-            body: JSON.stringify({ address_id: addressId, notes }),
+            body: JSON.stringify({ address_id: addressId, notes, coupon_code: couponCode, courier }),
         });
     }
 
@@ -165,23 +228,31 @@ class ApiClient {
         });
     }
 
-    // Payments
-    async createPayment(orderId: string) {
-        return this.request<{ snap_token: string; redirect_url: string }>(`/payments/${orderId}`, {
+    // Returns
+    async createReturn(orderId: string, items: { order_item_id: string; quantity: number }[], reason: string, photoUrls?: string[]) {
+        return this.request<ReturnRequest>(`/orders/${orderId}/returns`, {
             method: 'POST',
+            body: JSON.stringify({ items, reason, photo_urls: photoUrls }),
         });
     }
 
-    async getPaymentStatus(orderId: string) {
-        return this.request<Payment>(`/payments/${orderId}/status`);
+    async cancelReturn(orderId: string, returnId: string) {
+        return this.request<ReturnRequest>(`/orders/${orderId}/returns/${returnId}/cancel`, {
+            method: 'POST',
+        });
     }
 
-    async simulatePayment(orderId: string) {
-        return this.request<{ message: string }>(`/payments/${orderId}/simulate`, {
+    // Payments
+    async createPayment(orderId: string) {
+        return this.request<PaymentSession>(`/payments/${orderId}`, {
             method: 'POST',
         });
     }
 
+    async getPaymentStatus(orderId: string) {
+        return this.request<Payment>(`/payments/${orderId}/status`);
+    }
+
     // User
     async getProfile() {
         return this.request<User>('/users/profile');
@@ -255,10 +326,47 @@ class ApiClient {
         return this.request<Order>(`/admin/orders/${orderId}`);
     }
 
-    async adminUpdateOrderStatus(orderId: string, status: string, trackingNumber?: string) {
+    async adminGetOrderRefunds(orderId: string) {
+        return this.request<Refund[]>(`/admin/orders/${orderId}/refunds`);
+    }
+
+    async adminRefundOrder(orderId: string, reason: string, amount?: number) {
+        return this.request<{ refund: Refund; payment: Payment }>(`/admin/orders/${orderId}/refunds`, {
+            method: 'POST',
+            body: JSON.stringify({ reason, amount }),
+        });
+    }
+
+    async adminGetReturns(page?: number, status?: ReturnRequest['status']) {
+        const params = new URLSearchParams();
+        if (page) params.set('page', String(page));
+        if (status) params.set('status', status);
+        const query = params.toString() ? `?${params}` : '';
+        return this.request<ReturnsResponse>(`/admin/returns${query}`);
+    }
+
+    async adminGetReturn(returnId: string) {
+        return this.request<ReturnRequest>(`/admin/returns/${returnId}`);
+    }
+
+    async adminUpdateReturn(returnId: string, action: 'approve' | 'reject' | 'receive', note?: string) {
+        return this.request<ReturnRequest>(`/admin/returns/${returnId}/${action}`, {
+            method: 'POST',
+            body: JSON.stringify({ note }),
+        });
+    }
+
+    async adminResolveReturn(returnId: string, options: { restock: boolean; refund: boolean; refund_amount?: number; override_amount?: boolean; note?: string }) {
+        return this.request<ReturnRequest>(`/admin/returns/${returnId}/resolve`, {
+            method: 'POST',
+            body: JSON.stringify(options),
+        });
+    }
+
+    async adminUpdateOrderStatus(orderId: string, status: string, trackingNumber?: string, courier?: string) {
         return this.request<Order>(`/admin/orders/${orderId}/status`, {
             method: 'PUT',
-            body: JSON.stringify({ status, tracking_number: trackingNumber }),
+            body: JSON.stringify({ status, tracking_number: trackingNumber, courier }),
         });
     }
 
@@ -300,8 +408,14 @@ class ApiClient {
         guest_name: string;
         guest_phone: string;
         guest_address: string;
+        guest_city?: string;
+        guest_state?: string;
+        guest_postal_code?: string;
         notes?: string;
-        items: { product_id: string; variant_id?: string; quantity: number }[];
+        coupon_code?: string;
+        courier?: string;
+        // Leave out to check out the guest's server cart
+        items?: { product_id: string; variant_id?: string; quantity: number }[];
     }) {
         return this.request<Order>('/guest/order', {
             method: 'POST',
@@ -317,7 +431,7 @@ class ApiClient {
     }
 
     async createGuestPayment(orderId: string) {
-        return this.request<{ snap_token: string; redirect_url: string }>(`/guest/payment/${orderId}`, {
+        return this.request<PaymentSession>(`/guest/payment/${orderId}`, {
             method: 'POST',
         });
     }
@@ -333,6 +447,21 @@ class ApiClient {
     async getCouriers() {
         return this.request<{ couriers: Courier[] }>('/couriers');
     }
+
+    // Shipping
+    async quoteShipping(data: {
+        address_id?: string;
+        state?: string;
+        city?: string;
+        postal_code?: string;
+        courier?: string;
+        items?: { product_id: string; variant_id?: string; quantity: number }[];
+    }) {
+        return this.request<ShippingQuoteResponse>('/shipping/quote', {
+            method: 'POST',
+            body: JSON.stringify(data),
+        });
+    }
 }
 
 export const api = new ApiClient(API_URL);
@@ -367,6 +496,7 @@ export interface ProductVariant {
     value: string;
     price_modifier: number;
     stock: number;
+    weight: number;
 }
 
 export interface Product {
@@ -378,6 +508,7 @@ export interface Product {
     category_id: string;
     category?: Category;
     stock: number;
+    weight: number;
     is_active: boolean;
     is_featured: boolean;
     images: ProductImage[];
@@ -386,16 +517,24 @@ export interface Product {
     created_at: string;
 }
 
+export type ProductSort = 'relevance' | 'newest' | 'price_asc' | 'price_desc' | 'best_selling' | 'top_rated' | 'name';
+
 export interface ProductsParams {
     search?: string;
     category?: string;
     featured?: boolean;
     page?: number;
     limit?: number;
-    sort?: string;
-    order?: 'asc' | 'desc';
+    sort?: ProductSort;
+    order?: 'asc' | 'desc'; // defaults to the sort key's own direction
     minPrice?: number;
     maxPrice?: number;
+    categories?: string[];
+    attributes?: Record<string, string[]>; // variant name -> values, e.g. { Size: ['XL', 'L'] }
+    inStock?: boolean;
+    minRating?: number;
+    facets?: boolean;
+    cursor?: string; // '' for the first page; cursors only follow the newest sort
 }
 
 export interface ProductsResponse {
@@ -405,6 +544,33 @@ export interface ProductsResponse {
     limit: number;
     pages: number;
     total_pages: number;
+    search_mode?: 'fulltext' | 'fuzzy';
+    highlights?: Record<string, SearchHighlight>;
+    facets?: ProductFacets;
+    next_cursor?: string | null;
+    prev_cursor?: string | null;
+}
+
+// Each facet is counted with every other filter applied but not its own
+export interface ProductFacets {
+    categories: FacetValue[];
+    attributes: Record<string, FacetValue[]>;
+    in_stock: number;
+    ratings: FacetValue[]; // value is the minimum rating
+    price: { min: number; max: number };
+}
+
+export interface FacetValue {
+    value: string;
+    label?: string;
+    count: number;
+    selected: boolean;
+}
+
+// Matched words are wrapped in <mark>; the rest is HTML escaped
+export interface SearchHighlight {
+    name: string;
+    snippet: string;
 }
 
 export interface CreateProductInput {
@@ -420,17 +586,29 @@ export interface CreateProductInput {
 
 export interface CartItem {
     id: string;
+    user_id?: string;
     product_id: string;
     product: Product;
     variant_id?: string;
     variant?: ProductVariant;
     quantity: number;
+    added_price: number;
+}
+
+export interface CartWarning {
+    item_id: string;
+    code: 'unavailable' | 'out_of_stock' | 'quantity_reduced' | 'price_changed';
+    message: string;
+    available?: number;
+    old_price?: number;
+    new_price?: number;
 }
 
 export interface CartResponse {
     items: CartItem[];
     subtotal: number;
     count: number;
+    warnings: CartWarning[];
 }
 
 export interface WishlistItem {
@@ -476,10 +654,17 @@ export interface Order {
     status: 'pending' | 'paid' | 'processing' | 'shipped' | 'delivered' | 'cancelled';
     subtotal: number;
     shipping_fee: number;
+    shipping_weight: number;
+    courier?: string;
+    discount: number;
+    coupon_code?: string;
     total: number;
     notes: string;
     // Shipping info
     tracking_number?: string;
+    tracking_status?: string;
+    tracking_checked_at?: string;
+    shipment_events?: ShipmentEvent[];
     shipped_at?: string;
     delivered_at?: string;
     // Guest checkout fields
@@ -490,29 +675,129 @@ export interface Order {
 
     items: OrderItem[];
     payment?: Payment;
+    status_history?: OrderStatusHistory[];
+    returns?: ReturnRequest[];
+    created_at: string;
+}
+
+export interface OrderStatusHistory {
+    id: string;
+    order_id: string;
+    from_status: Order['status'] | '';
+    to_status: Order['status'];
+    actor_id?: string;
+    actor_role: 'customer' | 'admin' | 'guest' | 'system';
+    reason: string;
     created_at: string;
 }
 
+// Cursor mode returns the cursors instead of total, page and pages
 export interface OrdersResponse {
     orders: Order[];
     total: number;
     page: number;
     limit: number;
     pages: number;
+    next_cursor?: string | null;
+    prev_cursor?: string | null;
 }
 
 export interface Payment {
     id: string;
     order_id: string;
     midtrans_id: string;
-    status: 'pending' | 'success' | 'failed' | 'expired';
+    status: 'pending' | 'success' | 'failed' | 'expired' | 'refunded' | 'partially_refunded';
     method: string;
     amount: number;
+    refunded_amount: number;
+    refunds?: Refund[];
     snap_token?: string;
     redirect_url?: string;
     paid_at?: string;
 }
 
+export interface Refund {
+    id: string;
+    payment_id: string;
+    order_id: string;
+    amount: number;
+    reason: string;
+    status: 'pending' | 'succeeded' | 'failed';
+    refund_key: string;
+    provider_reference?: string;
+    failure_reason?: string;
+    completed_at?: string;
+    created_at: string;
+}
+
+export interface ReturnRequest {
+    id: string;
+    order_id: string;
+    user_id?: string;
+    status: 'requested' | 'approved' | 'rejected' | 'cancelled' | 'received' | 'completed';
+    reason: string;
+    photo_urls: string[] | null;
+    admin_note?: string;
+    restocked: boolean;
+    refund_id?: string;
+    refund?: Refund;
+    received_at?: string;
+    resolved_at?: string;
+    order?: Order;
+    items?: ReturnItem[];
+    history?: ReturnStatusHistory[];
+    created_at: string;
+    updated_at: string;
+}
+
+export interface ReturnItem {
+    id: string;
+    return_id: string;
+    order_item_id: string;
+    quantity: number;
+    order_item?: OrderItem;
+}
+
+export interface ReturnStatusHistory {
+    id: string;
+    return_id: string;
+    from_status?: ReturnRequest['status'];
+    to_status: ReturnRequest['status'];
+    actor_id?: string;
+    actor_role: 'customer' | 'admin' | 'guest' | 'system';
+    note?: string;
+    created_at: string;
+}
+
+export interface ReturnsResponse {
+    returns: ReturnRequest[];
+    total: number;
+    page: number;
+    limit: number;
+    pages: number;
+}
+
+export interface ShippingQuote {
+    courier: string;
+    courier_name: string;
+    zone: string;
+    weight: number;
+    fee: number;
+    free_shipping: boolean;
+}
+
+export interface ShippingQuoteResponse {
+    weight: number;
+    subtotal: number;
+    quotes: ShippingQuote[];
+}
+
+export interface PaymentSession {
+    snap_token: string;
+    redirect_url: string;
+    provider: 'midtrans' | 'fake';
+}
+
 export interface Review {
     id: string;
     product_id: string;
@@ -523,6 +808,14 @@ export interface Review {
     created_at: string;
 }
 
+export interface ShipmentEvent {
+    id: string;
+    time: string;
+    status: string;
+    description: string;
+    location: string;
+}
+
 export interface Courier {
     code: string;
     name: string;
@@ -530,6 +823,9 @@ export interface Courier {
 
 export interface TrackingHistory {
     date: string;
+    time: string;
+    timestamp: string;
+    status: string;
     description: string;
     location?: string;
 }
@@ -539,7 +835,9 @@ export interface TrackingResponse {
     data?: {
         tracking_number: string;
         courier: string;
+        courier_name: string;
         status: string;
+        delivered_at?: string;
         history: TrackingHistory[];
     };
     error?: string;